@@ -0,0 +1,152 @@
+// configtool 配置调试工具
+//
+//	configtool dump [-format yaml|json] app.yaml     输出展开环境变量和secret后实际生效的配置，secret会被隐藏
+//	configtool diff old.yaml new.yaml                比较两个配置实际生效的差异，有差异时退出码为1
+//	configtool example -type config.v1.DbConfig     根据proto生成带注释的示例yaml
+//	configtool schema -type config.v1.DbConfig      根据proto生成JSON Schema
+//
+// 编译进程序的proto描述不包含源码信息，生成的示例和JSON Schema中没有字段注释
+// 需要注释时通过-descriptor_set指定包含源码信息的FileDescriptorSet，例如：
+//
+//	protoc --include_source_info --include_imports --descriptor_set_out=config.binpb config.proto
+//	buf build -o config.binpb
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/byteflowing/go-common/config"
+	_ "github.com/byteflowing/proto/gen/go/config/v1"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	var err error
+	switch cmd {
+	case "dump":
+		err = dump(args)
+	case "diff":
+		err = diff(args)
+	case "example", "schema":
+		err = generate(cmd, args)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  configtool dump [-format yaml|json] <file>
+  configtool diff <old> <new>
+  configtool example -type <proto message> [-descriptor_set <file>]
+  configtool schema -type <proto message> [-descriptor_set <file>]
+
+compiled-in descriptors carry no source info, so field comments are only
+emitted when -descriptor_set points to a FileDescriptorSet built with
+--include_source_info (e.g. buf build -o config.binpb)`)
+	os.Exit(2)
+}
+
+func dump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	format := fs.String("format", string(config.FormatYAML), "output format: yaml or json")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	data, err := config.Dump(fs.Arg(0), config.Format(*format))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func diff(args []string) error {
+	if len(args) != 2 {
+		usage()
+	}
+	changes, err := config.Diff(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func generate(cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	name := fs.String("type", "", "full name of the proto message, e.g. config.v1.DbConfig")
+	descriptorSet := fs.String("descriptor_set", "", "FileDescriptorSet with source info, used for field comments")
+	_ = fs.Parse(args)
+	if *name == "" {
+		usage()
+	}
+	desc, err := findMessage(protoreflect.FullName(*name), *descriptorSet)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *name, err)
+	}
+	var data []byte
+	if cmd == "example" {
+		data, err = config.ExampleYAML(desc)
+	} else {
+		data, err = config.JSONSchema(desc)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// findMessage descriptorSet为空时使用编译进程序的proto描述
+func findMessage(name protoreflect.FullName, descriptorSet string) (protoreflect.MessageDescriptor, error) {
+	if descriptorSet == "" {
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return mt.Descriptor(), nil
+	}
+	data, err := os.ReadFile(descriptorSet)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := files.FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
@@ -3,7 +3,7 @@ package config
 import (
 	"bytes"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strings"
 
 	"github.com/byteflowing/go-common/jsonx"
@@ -13,10 +13,10 @@ import (
 )
 
 // ReadConfig 读取配置文件
-// 支持环境变量 ${VAR:-default}
+// 支持环境变量 ${VAR:-default}、${VAR:?message} 等和secret ${file:/run/secrets/db}，参考expandEnv
 func ReadConfig(file string, config interface{}) (err error) {
 	v := viper.New()
-	if err := readConfigAndExpendEvn(v, file); err != nil {
+	if _, err := readConfigAndExpendEvn(v, file); err != nil {
 		return err
 	}
 	return v.Unmarshal(config)
@@ -24,13 +24,42 @@ func ReadConfig(file string, config interface{}) (err error) {
 
 // ReadProtoConfig 读取配置文件，并将配置文件写入proto生成的结构中
 // 支持环境变量 ${VAR:-default}
-func ReadProtoConfig(file string, msg proto.Message) (err error) {
+// 解析和校验的错误汇总为*ValidationError返回，并带有文件的行号，校验参考WithValidator
+func ReadProtoConfig(file string, msg proto.Message, options ...ProtoOption) (err error) {
 	v := viper.New()
-	if err := readConfigAndExpendEvn(v, file); err != nil {
+	expanded, err := readConfigAndExpendEvn(v, file)
+	if err != nil {
+		return err
+	}
+	return decodeProto(file, expanded, v.AllSettings(), msg, options...)
+}
+
+// decodeProto 将settings写入msg并校验，expanded为展开后的配置文件，用于定位错误所在的行
+func decodeProto(file string, expanded []byte, settings map[string]any, msg proto.Message, options ...ProtoOption) error {
+	opts := &ProtoOpts{}
+	for _, op := range options {
+		op(opts)
+	}
+	nodes, err := parseConfigNodes(file, expanded, settings)
+	if err != nil {
 		return err
 	}
-	allSettings := v.AllSettings()
-	data, err := jsonx.Marshal(allSettings)
+	violations := nodes.checkUnknown(nodes.root, msg.ProtoReflect().Descriptor(), "", opts.DisallowUnknown)
+	if err := unmarshalProto(settings, msg); err != nil {
+		violations = append(violations, nodes.unmarshalViolation(err))
+	} else if opts.Validator != nil {
+		if err := opts.Validator.Validate(msg); err != nil {
+			violations = append(violations, nodes.validationViolations(err)...)
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func unmarshalProto(settings map[string]any, msg proto.Message) error {
+	data, err := jsonx.Marshal(normalizeKeys(settings, msg.ProtoReflect().Descriptor()))
 	if err != nil {
 		return err
 	}
@@ -40,50 +69,47 @@ func ReadProtoConfig(file string, msg proto.Message) (err error) {
 	return unmarshaler.Unmarshal(data, msg)
 }
 
-func readConfigAndExpendEvn(v *viper.Viper, file string) error {
+// readConfigAndExpendEvn 返回以占位符展开secret的内容，行号与配置文件一致，用于定位错误所在的行
+func readConfigAndExpendEvn(v *viper.Viper, file string) ([]byte, error) {
 	v.SetConfigFile(file)
 	v.AutomaticEnv()
 	v.AllowEmptyEnv(true)
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	if err := v.ReadInConfig(); err != nil {
-		return err
+		return nil, err
 	}
-	expended, err := expandEnvWithDefault(v.ConfigFileUsed())
+	expended, layout, err := expandEnvWithDefault(v.ConfigFileUsed())
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return v.ReadConfig(bytes.NewReader(expended))
+	return layout, v.ReadConfig(bytes.NewReader(expended))
 }
 
-func expandEnvWithDefault(file string) ([]byte, error) {
+// expandEnvWithDefault 展开环境变量和secret，语法参考expandEnv
+// yaml和json中的secret先展开为占位符(layout)，解析后再替换到对应的字符串节点中(expanded)，参考substituteSecrets
+// 其他格式的secret直接替换为原始内容，expanded和layout相同
+func expandEnvWithDefault(file string) (expanded, layout []byte, err error) {
 	raw, err := os.ReadFile(file)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	re := regexp.MustCompile(`\$\{([^}:]+)(?:(:-)([^}]*))?\}`)
-
-	expanded := re.ReplaceAllStringFunc(string(raw), func(m string) string {
-		matches := re.FindStringSubmatch(m)
-		if len(matches) < 2 {
-			return m // 安全兜底
-		}
-
-		key := matches[1] // 变量名
-		def := ""
-		if len(matches) >= 4 {
-			def = matches[3] // 默认值，可能为空
-		}
-
-		val, ok := os.LookupEnv(key)
-		if !ok {
-			return def // 未定义 → 用默认值或空
+	ext := strings.ToLower(filepath.Ext(file))
+	switch ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		s, err := expandEnv(file, string(raw))
+		if err != nil {
+			return nil, nil, err
 		}
-		if matches[2] == ":-" && val == "" {
-			return def // :-default 且空 → 用默认值
-		}
-		return val
-	})
-
-	return []byte(expanded), nil
+		return []byte(s), []byte(s), nil
+	}
+	s, secrets, err := expandConfig(file, string(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	expanded, err = substituteSecrets(file, []byte(s), secrets, ext == ".json")
+	if err != nil {
+		return nil, nil, err
+	}
+	return expanded, []byte(s), nil
 }
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExpandError 展开 ${...} 失败，Line从1开始
+type ExpandError struct {
+	File string
+	Line int
+	Expr string
+	Err  error
+}
+
+func (e *ExpandError) Error() string {
+	if e.Expr == "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: ${%s}: %v", e.File, e.Line, e.Expr, e.Err)
+}
+
+func (e *ExpandError) Unwrap() error {
+	return e.Err
+}
+
+// expandEnv 展开s中的环境变量和secret，支持的语法：
+//
+//	${VAR}           未设置时为空
+//	${VAR:-default}  未设置或者为空时使用default
+//	${VAR-default}   未设置时使用default
+//	${VAR:?message}  未设置或者为空时返回错误
+//	${VAR?message}   未设置时返回错误
+//	${VAR:+alt}      设置且不为空时使用alt，否则为空
+//	${VAR+alt}       设置时使用alt，否则为空
+//	${scheme:ref}    已注册的secret，参考RegisterSecretProvider
+//	$${...}          转义，原样输出 ${...}，其中嵌套的 ${...} 不展开
+//
+// default、message、alt和ref中可以嵌套 ${...}，只有用到时才会展开
+// secret直接替换为原始内容，yaml和json参考expandConfig
+func expandEnv(file, s string) (string, error) {
+	e := newExpander(file, false)
+	defer e.cancel()
+	expanded, err := e.expand(s, 1)
+	if err != nil {
+		return "", err
+	}
+	recordSecrets(file, e.resolved)
+	return expanded, nil
+}
+
+// expandConfig 展开s中的环境变量和secret，secret展开为占位符，通过secrets返回占位符对应的值，参考substituteSecrets
+func expandConfig(file, s string) (expanded string, secrets map[string]string, err error) {
+	e := newExpander(file, true)
+	defer e.cancel()
+	expanded, err = e.expand(s, 1)
+	if err != nil {
+		return "", nil, err
+	}
+	recordSecrets(file, e.resolved)
+	return expanded, e.secrets, nil
+}
+
+type expander struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	file     string
+	nonce    string            // 不为空时secret展开为占位符
+	secrets  map[string]string // 占位符 -> secret
+	resolved []string          // 本次展开解析出的secret，用于Redact
+}
+
+// newExpander 一次展开中所有secret的解析共享defaultSecretTimeout
+func newExpander(file string, placeholder bool) *expander {
+	e := &expander{file: file, secrets: map[string]string{}}
+	e.ctx, e.cancel = context.WithTimeout(context.Background(), defaultSecretTimeout)
+	if placeholder {
+		nonce := make([]byte, 8)
+		_, _ = rand.Read(nonce)
+		e.nonce = hex.EncodeToString(nonce)
+	}
+	return e
+}
+
+func (e *expander) expand(s string, line int) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			// 转义的表达式原样输出，嵌套的 ${...} 也不展开
+			end := matchBrace(s, i+3)
+			if end < 0 {
+				b.WriteString("${")
+				i += 3
+				continue
+			}
+			escaped := s[i+3 : end+1]
+			b.WriteString("${" + escaped)
+			line += strings.Count(escaped, "\n")
+			i = end + 1
+		case strings.HasPrefix(s[i:], "${"):
+			end := matchBrace(s, i+2)
+			if end < 0 {
+				return "", &ExpandError{File: e.file, Line: line, Err: fmt.Errorf("unclosed ${%s", firstLine(s[i+2:]))}
+			}
+			expr := s[i+2 : end]
+			value, err := e.eval(expr, line)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			line += strings.Count(expr, "\n")
+			i = end + 1
+		default:
+			if s[i] == '\n' {
+				line++
+			}
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+func (e *expander) eval(expr string, line int) (string, error) {
+	if scheme, ref, ok := splitSecret(expr); ok {
+		// ref中嵌套的secret需要原始内容
+		nonce := e.nonce
+		e.nonce = ""
+		ref, err := e.expand(ref, line)
+		e.nonce = nonce
+		if err != nil {
+			return "", err
+		}
+		value, err := resolveSecret(e.ctx, scheme, ref)
+		if err != nil {
+			return "", &ExpandError{File: e.file, Line: line, Expr: expr, Err: err}
+		}
+		e.resolved = append(e.resolved, value)
+		if e.nonce == "" {
+			return value, nil
+		}
+		placeholder := fmt.Sprintf("__config_secret_%s_%d__", e.nonce, len(e.secrets))
+		e.secrets[placeholder] = value
+		return placeholder, nil
+	}
+	n := 0
+	for n < len(expr) && isNameChar(expr[n]) {
+		n++
+	}
+	name, rest := expr[:n], expr[n:]
+	if name == "" {
+		return "", &ExpandError{File: e.file, Line: line, Expr: expr, Err: errors.New("missing variable name")}
+	}
+	value, set := os.LookupEnv(name)
+	if rest == "" {
+		return value, nil
+	}
+	colon := strings.HasPrefix(rest, ":")
+	op := strings.TrimPrefix(rest, ":")
+	if op == "" {
+		return "", &ExpandError{File: e.file, Line: line, Expr: expr, Err: errors.New("invalid syntax")}
+	}
+	word := op[1:]
+	// 带冒号时空值与未设置相同
+	present := set && (!colon || value != "")
+	switch op[0] {
+	case '-':
+		if present {
+			return value, nil
+		}
+		return e.expand(word, line)
+	case '?':
+		if present {
+			return value, nil
+		}
+		message, err := e.expand(word, line)
+		if err != nil {
+			return "", err
+		}
+		if message == "" {
+			message = name + " is required"
+		}
+		return "", &ExpandError{File: e.file, Line: line, Expr: expr, Err: errors.New(message)}
+	case '+':
+		if !present {
+			return "", nil
+		}
+		return e.expand(word, line)
+	}
+	return "", &ExpandError{File: e.file, Line: line, Expr: expr, Err: errors.New("invalid syntax")}
+}
+
+// matchBrace 返回与start之前的 ${ 匹配的 } 的位置，支持嵌套
+func matchBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitSecret expr为已注册的 scheme:ref 时返回true，scheme只包含小写字母和数字
+// 先于 ${VAR:-default} 等语法判断，ref可以以 - ? + 开头（例如base64的 +），与scheme同名的环境变量不能使用带冒号的语法
+func splitSecret(expr string) (scheme, ref string, ok bool) {
+	i := strings.IndexByte(expr, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+	scheme, ref = expr[:i], expr[i+1:]
+	for j := 0; j < len(scheme); j++ {
+		c := scheme[j]
+		if !(c >= 'a' && c <= 'z' || j > 0 && c >= '0' && c <= '9') {
+			return "", "", false
+		}
+	}
+	return scheme, ref, hasSecretProvider(scheme)
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
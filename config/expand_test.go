@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("EXPAND_SET", "v")
+	t.Setenv("EXPAND_EMPTY", "")
+	cases := map[string]string{
+		"${EXPAND_SET}":                        "v",
+		"${EXPAND_UNSET}":                      "",
+		"${EXPAND_EMPTY:-d}":                   "d",
+		"${EXPAND_EMPTY-d}":                    "",
+		"${EXPAND_UNSET-d}":                    "d",
+		"${EXPAND_SET:+alt}":                   "alt",
+		"${EXPAND_EMPTY:+alt}":                 "",
+		"${EXPAND_EMPTY+alt}":                  "alt",
+		"${EXPAND_UNSET:-${EXPAND_SET}}":       "v",
+		"${EXPAND_UNSET:-a-${X:-${Y:-b}}}":     "a-b",
+		"${EXPAND_SET:-${EXPAND_UNSET:?}}":     "v",
+		"$${EXPAND_SET} $$HOME ${base64:eA==}": "${EXPAND_SET} $$HOME x",
+		"$${A:-${EXPAND_SET}} ${EXPAND_SET}":   "${A:-${EXPAND_SET}} v",
+		"${base64:+w==}":                       "\xfb",
+	}
+	for in, want := range cases {
+		got, err := expandEnv("app.yaml", in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := expandEnv("app.yaml", "a: 1\nb: ${EXPAND_EMPTY:?b is required}\n")
+	var expandErr *ExpandError
+	assert.True(t, errors.As(err, &expandErr))
+	assert.Equal(t, "app.yaml:2: ${EXPAND_EMPTY:?b is required}: b is required", err.Error())
+
+	_, err = expandEnv("app.yaml", "a: |\n  ${EXPAND_SET:-\n  x}\nb: ${EXPAND_UNSET?}\n")
+	assert.EqualError(t, err, "app.yaml:4: ${EXPAND_UNSET?}: EXPAND_UNSET is required")
+
+	_, err = expandEnv("app.yaml", "a: 1\nb: ${EXPAND_SET\n")
+	assert.EqualError(t, err, "app.yaml:2: unclosed ${EXPAND_SET")
+}
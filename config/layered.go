@@ -0,0 +1,332 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultProfileEnv = "APP_PROFILE"
+	defaultLocalName  = "local"
+	layerEnv          = "env"
+	layerFlag         = "flag"
+)
+
+type LayeredOpts struct {
+	// ProfileEnv 选择profile的环境变量，默认APP_PROFILE，例如APP_PROFILE=prod时读取base同目录下的prod.yaml
+	ProfileEnv string
+	// Overlays 在profile之后合并的文件，例如按照地域区分的配置，文件不存在时返回错误
+	Overlays []string
+	// LocalName 本地覆盖文件的名称（不含扩展名），默认local，文件不存在时忽略
+	LocalName string
+	// EnvPrefix 环境变量前缀，配置db.host对应的环境变量为 EnvPrefix + DB_HOST
+	EnvPrefix string
+	// Flags 命令行参数，只有显式设置的参数会生效，参数名为配置的路径，例如 -db.host=127.0.0.1
+	Flags *flag.FlagSet
+	// ProtoOptions ReadLayeredProtoConfig解析配置的选项，与ReadProtoConfig相同
+	ProtoOptions []ProtoOption
+}
+
+type LayeredOption func(o *LayeredOpts)
+
+// WithProfileEnv : 设置选择profile的环境变量
+func WithProfileEnv(env string) LayeredOption {
+	return func(o *LayeredOpts) {
+		o.ProfileEnv = env
+	}
+}
+
+// WithOverlays : 设置在profile之后合并的文件
+func WithOverlays(files ...string) LayeredOption {
+	return func(o *LayeredOpts) {
+		o.Overlays = append(o.Overlays, files...)
+	}
+}
+
+// WithLocalName : 设置本地覆盖文件的名称
+func WithLocalName(name string) LayeredOption {
+	return func(o *LayeredOpts) {
+		o.LocalName = name
+	}
+}
+
+// WithEnvPrefix : 设置环境变量前缀
+func WithEnvPrefix(prefix string) LayeredOption {
+	return func(o *LayeredOpts) {
+		o.EnvPrefix = prefix
+	}
+}
+
+// WithFlags : 设置命令行参数，需要在flag.Parse之后调用LoadLayers
+func WithFlags(fs *flag.FlagSet) LayeredOption {
+	return func(o *LayeredOpts) {
+		o.Flags = fs
+	}
+}
+
+// WithLayeredProtoOptions : 设置ReadLayeredProtoConfig解析配置的选项，例如WithDisallowUnknown、WithValidator
+func WithLayeredProtoOptions(options ...ProtoOption) LayeredOption {
+	return func(o *LayeredOpts) {
+		o.ProtoOptions = append(o.ProtoOptions, options...)
+	}
+}
+
+// Explain 每个配置项的来源
+type Explain map[string]string
+
+// String 按照配置路径排序输出，例如 db.host <- prod.yaml
+func (e Explain) String() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s <- %s\n", k, e[k])
+	}
+	return b.String()
+}
+
+// LoadLayers 按顺序合并多层配置：base文件、profile文件、overlay文件、local文件、环境变量、命令行参数
+// 合并规则：map递归合并；list和标量整体替换；上层显式设置为null时删除该配置
+// 环境变量和命令行参数只能覆盖已经存在的配置，值按照yaml标量解析
+// 每个文件都支持环境变量 ${VAR:-default}
+func LoadLayers(base string, options ...LayeredOption) (map[string]any, Explain, error) {
+	opts := &LayeredOpts{
+		ProfileEnv: defaultProfileEnv,
+		LocalName:  defaultLocalName,
+	}
+	for _, op := range options {
+		op(opts)
+	}
+	settings := map[string]any{}
+	explain := Explain{}
+	merge := func(name string, layer map[string]any) {
+		mergeSettings(settings, layer, "", name, explain)
+	}
+
+	baseSettings, err := readSettings(base)
+	if err != nil {
+		return nil, nil, err
+	}
+	merge(filepath.Base(base), baseSettings)
+
+	dir, ext := filepath.Dir(base), filepath.Ext(base)
+	var files []string
+	if profile := os.Getenv(opts.ProfileEnv); opts.ProfileEnv != "" && profile != "" {
+		files = append(files, filepath.Join(dir, profile+ext))
+	}
+	files = append(files, opts.Overlays...)
+	for _, file := range files {
+		layer, err := readSettings(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		merge(filepath.Base(file), layer)
+	}
+	if opts.LocalName != "" {
+		local := filepath.Join(dir, opts.LocalName+ext)
+		if _, err := os.Stat(local); err == nil {
+			layer, err := readSettings(local)
+			if err != nil {
+				return nil, nil, err
+			}
+			merge(filepath.Base(local), layer)
+		}
+	}
+
+	envLayer := map[string]any{}
+	for _, path := range leafPaths(settings, "") {
+		name := opts.EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+		if value, ok := os.LookupEnv(name); ok {
+			if err := setPath(envLayer, path, parseScalar(value)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	merge(layerEnv, envLayer)
+
+	if opts.Flags != nil {
+		flagLayer := map[string]any{}
+		var flagErr error
+		opts.Flags.Visit(func(f *flag.Flag) {
+			if flagErr == nil && hasPath(settings, f.Name) {
+				flagErr = setPath(flagLayer, strings.ToLower(f.Name), parseScalar(f.Value.String()))
+			}
+		})
+		if flagErr != nil {
+			return nil, nil, flagErr
+		}
+		merge(layerFlag, flagLayer)
+	}
+	return settings, explain, nil
+}
+
+// ReadLayeredConfig 读取多层配置，参考LoadLayers
+func ReadLayeredConfig(base string, config interface{}, options ...LayeredOption) error {
+	settings, _, err := LoadLayers(base, options...)
+	if err != nil {
+		return err
+	}
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return err
+	}
+	return v.Unmarshal(config)
+}
+
+// ReadLayeredProtoConfig 读取多层配置，并将配置写入proto生成的结构中，参考LoadLayers
+// 未知字段和校验与ReadProtoConfig相同，参考WithLayeredProtoOptions，合并后的配置无法定位到行
+func ReadLayeredProtoConfig(base string, msg proto.Message, options ...LayeredOption) error {
+	opts := &LayeredOpts{}
+	for _, op := range options {
+		op(opts)
+	}
+	settings, _, err := LoadLayers(base, options...)
+	if err != nil {
+		return err
+	}
+	return decodeProto(base, nil, settings, msg, opts.ProtoOptions...)
+}
+
+// readSettings 读取单个文件并展开环境变量，不读取viper的AutomaticEnv，key统一转为小写
+// yaml和json直接解析以保留null，其他格式使用viper解析
+func readSettings(file string) (map[string]any, error) {
+	expanded, _, err := expandEnvWithDefault(file)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		settings := map[string]any{}
+		if err := yaml.Unmarshal(expanded, &settings); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return lowerKeys(settings), nil
+	}
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadConfig(bytes.NewReader(expanded)); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return v.AllSettings(), nil
+}
+
+func lowerKeys(settings map[string]any) map[string]any {
+	lowered := make(map[string]any, len(settings))
+	for k, v := range settings {
+		if m, ok := v.(map[string]any); ok {
+			v = lowerKeys(m)
+		}
+		lowered[strings.ToLower(k)] = v
+	}
+	return lowered
+}
+
+func mergeSettings(dst, src map[string]any, prefix, layer string, explain Explain) {
+	for k, v := range src {
+		path := joinPath(prefix, k)
+		if v == nil {
+			delete(dst, k)
+			explain.remove(path)
+			continue
+		}
+		if srcMap, ok := v.(map[string]any); ok {
+			dstMap, ok := dst[k].(map[string]any)
+			if !ok {
+				dstMap = map[string]any{}
+				dst[k] = dstMap
+				explain.remove(path)
+			}
+			mergeSettings(dstMap, srcMap, path, layer, explain)
+			continue
+		}
+		dst[k] = v
+		explain.remove(path)
+		explain[path] = layer
+	}
+}
+
+func (e Explain) remove(path string) {
+	delete(e, path)
+	for k := range e {
+		if strings.HasPrefix(k, path+".") {
+			delete(e, k)
+		}
+	}
+}
+
+func leafPaths(settings map[string]any, prefix string) []string {
+	var paths []string
+	for k, v := range settings {
+		path := joinPath(prefix, k)
+		if m, ok := v.(map[string]any); ok {
+			paths = append(paths, leafPaths(m, path)...)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func hasPath(settings map[string]any, path string) bool {
+	keys := strings.Split(strings.ToLower(path), ".")
+	var cur any = settings
+	for _, k := range keys {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return false
+		}
+		if cur, ok = m[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func setPath(settings map[string]any, path string, value any) error {
+	keys := strings.Split(path, ".")
+	m := settings
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k]
+		if !ok {
+			next = map[string]any{}
+			m[k] = next
+		}
+		if m, ok = next.(map[string]any); !ok {
+			return fmt.Errorf("config: %s is not a map", path)
+		}
+	}
+	m[keys[len(keys)-1]] = value
+	return nil
+}
+
+// parseScalar 按照yaml标量解析，例如 true、10、1.5，解析失败时作为字符串
+func parseScalar(s string) any {
+	var v any
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil || v == nil {
+		return s
+	}
+	switch v.(type) {
+	case map[string]any, []any:
+		return s
+	}
+	return v
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+		return file
+	}
+	base := write("base.yaml", "db:\n  host: localhost\n  port: 3306\n  tags: [a, b]\nlog:\n  level: info\n  file: app.log\n")
+	write("prod.yaml", "db:\n  host: prod-db\n  tags: [c]\nlog:\n  file: null\n")
+	region := write("region.yaml", "db:\n  port: 3307\n")
+	write("local.yaml", "log:\n  level: debug\n")
+	t.Setenv("APP_PROFILE", "prod")
+	t.Setenv("TEST_DB_PORT", "3308")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("db.host", "", "")
+	fs.String("unknown", "", "")
+	assert.NoError(t, fs.Parse([]string{"-db.host=flag-db", "-unknown=x"}))
+
+	settings, explain, err := LoadLayers(base, WithOverlays(region), WithEnvPrefix("TEST_"), WithFlags(fs))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"db":  map[string]any{"host": "flag-db", "port": 3308, "tags": []any{"c"}},
+		"log": map[string]any{"level": "debug"},
+	}, settings)
+	assert.Equal(t, Explain{
+		"db.host":   "flag",
+		"db.port":   "env",
+		"db.tags":   "prod.yaml",
+		"log.level": "local.yaml",
+	}, explain)
+}
+
+func TestReadLayeredProtoConfig(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	overlay := filepath.Join(dir, "overlay.yaml")
+	assert.NoError(t, os.WriteFile(base, []byte("name: app\nmaxIdleConns: 5\n"), 0o644))
+	assert.NoError(t, os.WriteFile(overlay, []byte("servers:\n  - host: a\nnmae: typo\n"), 0o644))
+
+	msg := newTestMessage(t)
+	assert.NoError(t, ReadLayeredProtoConfig(base, msg, WithOverlays(overlay)))
+	assert.Equal(t, int64(5), msg.Get(msg.Descriptor().Fields().ByName("max_idle_conns")).Int())
+
+	// 与ReadProtoConfig一样检查未知字段并校验
+	err := ReadLayeredProtoConfig(base, newTestMessage(t), WithOverlays(overlay),
+		WithLayeredProtoOptions(WithDisallowUnknown(), WithValidator(ProtoValidator)))
+	var verr *ValidationError
+	assert.True(t, errors.As(err, &verr))
+	assert.Equal(t, []Violation{
+		{File: base, Path: "nmae", Message: "unknown field"},
+		{File: base, Path: "servers[0].port", Message: "value is required"},
+	}, verr.Violations)
+}
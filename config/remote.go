@@ -0,0 +1,233 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/byteflowing/go-common/jsonx"
+	"github.com/byteflowing/go-common/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"go.yaml.in/yaml/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultRemoteTimeout = 3 * time.Second
+	defaultRemoteRefresh = time.Minute
+	layerRemote          = "remote"
+)
+
+// RemoteSource 远程配置，远程配置会合并到文件配置之上
+type RemoteSource interface {
+	// Load 读取远程配置，key为配置的路径，没有远程配置时返回空map
+	Load(ctx context.Context) (map[string]any, error)
+	// Watch 阻塞监听远程配置的变更，变更时调用notify，ctx取消时返回
+	Watch(ctx context.Context, notify func()) error
+}
+
+type RedisSourceOpts struct {
+	// Channel 通过pub/sub通知变更，修改配置后需要 PUBLISH Channel 任意内容
+	// 为空时使用keyspace通知，需要redis开启 notify-keyspace-events Kg$h；redis集群需要使用Channel
+	Channel string
+	// Refresh 定时重新读取，断线期间的通知会丢失，默认1分钟，<=0时不定时读取
+	Refresh time.Duration
+}
+
+type RedisSourceOption func(o *RedisSourceOpts)
+
+// WithRedisChannel : 通过pub/sub通知变更
+func WithRedisChannel(channel string) RedisSourceOption {
+	return func(o *RedisSourceOpts) {
+		o.Channel = channel
+	}
+}
+
+// WithRedisRefresh : 设置定时重新读取的间隔
+func WithRedisRefresh(d time.Duration) RedisSourceOption {
+	return func(o *RedisSourceOpts) {
+		o.Refresh = d
+	}
+}
+
+type redisSource struct {
+	r    *redis.Redis
+	key  string
+	opts *RedisSourceOpts
+}
+
+// NewRedisSource 从redis读取远程配置
+// key为string时，值为yaml或json格式的配置
+// key为hash时，field为配置的路径，例如 limits.qps，值按照yaml解析
+func NewRedisSource(r *redis.Redis, key string, options ...RedisSourceOption) RemoteSource {
+	opts := &RedisSourceOpts{Refresh: defaultRemoteRefresh}
+	for _, op := range options {
+		op(opts)
+	}
+	return &redisSource{r: r, key: key, opts: opts}
+}
+
+func (s *redisSource) Load(ctx context.Context) (map[string]any, error) {
+	typ, err := s.r.Type(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]any{}
+	switch typ {
+	case "none":
+	case "string":
+		data, err := s.r.Get(ctx, s.key).Bytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("config: redis key %s: %w", s.key, err)
+		}
+	case "hash":
+		fields, err := s.r.HGetAll(ctx, s.key).Result()
+		if err != nil {
+			return nil, err
+		}
+		for field, value := range fields {
+			if err := setPath(settings, strings.ToLower(field), parseValue(value)); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("config: redis key %s has unsupported type %s", s.key, typ)
+	}
+	return lowerKeys(settings), nil
+}
+
+func (s *redisSource) Watch(ctx context.Context, notify func()) error {
+	client, ok := s.r.Cmdable.(goredis.UniversalClient)
+	if !ok {
+		return errors.New("config: redis client does not support pub/sub")
+	}
+	var pubsub *goredis.PubSub
+	if s.opts.Channel != "" {
+		pubsub = client.Subscribe(ctx, s.opts.Channel)
+	} else {
+		pubsub = client.PSubscribe(ctx, "__keyspace@*__:"+s.key)
+	}
+	defer pubsub.Close()
+	var refresh <-chan time.Time
+	if s.opts.Refresh > 0 {
+		ticker := time.NewTicker(s.opts.Refresh)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			notify()
+		case <-refresh:
+			notify()
+		}
+	}
+}
+
+// WithRemote : 将远程配置合并到文件配置之上，并监听远程配置的变更
+// snapshot为本地快照文件，每次读取成功后写入；启动时远程配置不可用则使用快照，为空时不使用快照
+// 运行期间远程配置不可用时继续使用上一次读取成功的远程配置
+func WithRemote[T proto.Message](source RemoteSource, snapshot string) WatcherOption[T] {
+	return func(o *WatcherOpts[T]) {
+		o.Remote = source
+		o.Snapshot = snapshot
+	}
+}
+
+// loadRemote 读取远程配置，失败时依次使用内存中和快照中最后一次成功的配置
+func (w *Watcher[T]) loadRemote() (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRemoteTimeout)
+	defer cancel()
+	settings, err := w.opts.Remote.Load(ctx)
+	if err == nil {
+		w.remote.Store(&settings)
+		if w.opts.Snapshot != "" {
+			if err := writeSnapshot(w.opts.Snapshot, settings); err != nil {
+				w.opts.OnError(err)
+			}
+		}
+		return settings, nil
+	}
+	err = fmt.Errorf("config: load remote: %w", err)
+	if last := w.remote.Load(); last != nil {
+		w.opts.OnError(err)
+		return *last, nil
+	}
+	if w.opts.Snapshot == "" {
+		return nil, err
+	}
+	data, snapshotErr := os.ReadFile(w.opts.Snapshot)
+	if snapshotErr != nil {
+		return nil, errors.Join(err, snapshotErr)
+	}
+	if snapshotErr = jsonx.Unmarshal(data, &settings); snapshotErr != nil {
+		return nil, errors.Join(err, snapshotErr)
+	}
+	w.opts.OnError(err)
+	w.remote.Store(&settings)
+	return settings, nil
+}
+
+func (w *Watcher[T]) watchRemote(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	for ctx.Err() == nil {
+		err := w.opts.Remote.Watch(ctx, func() {
+			if err := w.Reload(); err != nil {
+				w.opts.OnError(err)
+			}
+		})
+		if err != nil {
+			w.opts.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// writeSnapshot 先写临时文件再rename，避免进程退出时留下不完整的快照
+func writeSnapshot(file string, settings map[string]any) error {
+	data, err := jsonx.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// parseValue 按照yaml解析，解析失败时作为字符串
+func parseValue(s string) any {
+	var v any
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil || v == nil {
+		return s
+	}
+	if m, ok := v.(map[string]any); ok {
+		return lowerKeys(m)
+	}
+	return v
+}
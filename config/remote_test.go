@@ -0,0 +1,84 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type stubSource struct {
+	mu       sync.Mutex
+	settings map[string]any
+	err      error
+	notify   chan struct{}
+}
+
+func (s *stubSource) Load(ctx context.Context) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings, s.err
+}
+
+func (s *stubSource) Watch(ctx context.Context, notify func()) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.notify:
+			notify()
+		}
+	}
+}
+
+func (s *stubSource) set(settings map[string]any, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings, s.err = settings, err
+}
+
+func TestWatcherRemote(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	snapshot := filepath.Join(dir, "remote.json")
+	assert.NoError(t, os.WriteFile(file, []byte("limits:\n  qps: 10\n  burst: 20\n"), 0o644))
+	newMsg := func() *structpb.Struct { return &structpb.Struct{} }
+	qps := func(msg *structpb.Struct) float64 {
+		return msg.Fields["limits"].GetStructValue().Fields["qps"].GetNumberValue()
+	}
+
+	source := &stubSource{notify: make(chan struct{})}
+	source.set(map[string]any{"limits": map[string]any{"qps": 100}}, nil)
+	w, err := NewWatcher(file, newMsg, WithRemote[*structpb.Struct](source, snapshot), WithOnError[*structpb.Struct](func(err error) {}))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), qps(w.Get()))
+	assert.Equal(t, float64(20), w.Get().Fields["limits"].GetStructValue().Fields["burst"].GetNumberValue())
+
+	changes := make(chan float64, 1)
+	w.Subscribe(func(old, new *structpb.Struct) { changes <- qps(new) })
+	assert.NoError(t, w.Watch())
+	source.set(map[string]any{"limits": map[string]any{"qps": 200}}, nil)
+	source.notify <- struct{}{}
+	select {
+	case v := <-changes:
+		assert.Equal(t, float64(200), v)
+	case <-time.After(3 * time.Second):
+		t.Fatal("no change notified")
+	}
+	w.Stop()
+
+	// 启动时远程配置不可用，使用快照
+	source.set(nil, errors.New("unreachable"))
+	w, err = NewWatcher(file, newMsg, WithRemote[*structpb.Struct](source, snapshot), WithOnError[*structpb.Struct](func(err error) {}))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(200), qps(w.Get()))
+
+	_, err = NewWatcher(file, newMsg, WithRemote[*structpb.Struct](source, filepath.Join(dir, "missing.json")))
+	assert.Error(t, err)
+}
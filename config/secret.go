@@ -0,0 +1,264 @@
+package config
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byteflowing/go-common/jsonx"
+	"go.yaml.in/yaml/v3"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// SecretKeyEnv enc的默认密钥，base64编码的16/24/32字节AES密钥
+	SecretKeyEnv = "CONFIG_SECRET_KEY"
+	redacted     = "******"
+	// minRedactLength 短于该长度的secret不隐藏，避免日志中相同的短字符串都被替换
+	minRedactLength      = 4
+	defaultSecretTimeout = 10 * time.Second
+)
+
+var ErrInvalidSecret = errors.New("config: invalid secret")
+
+// SecretProvider 解析配置中的 ${scheme:ref}，例如Vault等外部存储
+// 读取一个配置文件时所有secret的解析共用一个ctx，超时时间为10秒
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretProviderFunc 将函数转换为SecretProvider
+type SecretProviderFunc func(ctx context.Context, ref string) (string, error)
+
+func (f SecretProviderFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+var (
+	secretMu        sync.RWMutex
+	secretProviders = map[string]SecretProvider{
+		"file":   SecretProviderFunc(resolveFileSecret),
+		"base64": SecretProviderFunc(resolveBase64Secret),
+		"enc":    SecretProviderFunc(resolveEnvKeySecret),
+	}
+	resolvedSecrets = map[string][]string{} // 配置文件 -> 最近一次读取时解析出的secret
+)
+
+// RegisterSecretProvider 注册secret provider，配置中使用 ${scheme:ref}，相同的scheme会覆盖已有的provider
+// 内置的scheme：
+//   - file：读取文件内容并去掉末尾的换行，例如 ${file:/run/secrets/db}
+//   - base64：base64解码，例如 ${base64:cGFzc3dvcmQ=}
+//   - enc：AES-GCM解密，密钥来自环境变量CONFIG_SECRET_KEY，密文通过EncryptSecret生成
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretProviders[scheme] = provider
+}
+
+// NewAESSecretProvider 使用指定的密钥解密enc，用法：RegisterSecretProvider("enc", NewAESSecretProvider(key))
+func NewAESSecretProvider(key []byte) SecretProvider {
+	return SecretProviderFunc(func(ctx context.Context, ref string) (string, error) {
+		return decryptSecret(key, ref)
+	})
+}
+
+// EncryptSecret 使用AES-GCM加密，返回值写在配置中：${enc:返回值}
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Redact 将字符串中已经解析过的secret替换为******，用于输出日志
+// 每个配置文件只保留最近一次读取时解析出的secret；短于4个字符的secret不会被替换
+func Redact(s string) string {
+	secretMu.RLock()
+	seen := map[string]struct{}{}
+	var values []string
+	for _, secrets := range resolvedSecrets {
+		for _, v := range secrets {
+			if _, ok := seen[v]; !ok {
+				seen[v] = struct{}{}
+				values = append(values, v)
+			}
+		}
+	}
+	secretMu.RUnlock()
+	// 先替换较长的secret，避免被其中包含的较短的secret拆开
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, v := range values {
+		s = strings.ReplaceAll(s, v, redacted)
+		if escaped := jsonEscape(v); escaped != v {
+			s = strings.ReplaceAll(s, escaped, redacted)
+		}
+	}
+	return s
+}
+
+// Redacted 将配置序列化为json并隐藏其中的secret，proto使用protojson
+func Redacted(v any) string {
+	var (
+		data []byte
+		err  error
+	)
+	if msg, ok := v.(proto.Message); ok {
+		data, err = protojson.Marshal(msg)
+	} else {
+		data, err = jsonx.Marshal(v)
+	}
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return Redact(string(data))
+}
+
+func hasSecretProvider(scheme string) bool {
+	secretMu.RLock()
+	defer secretMu.RUnlock()
+	_, ok := secretProviders[scheme]
+	return ok
+}
+
+func resolveSecret(ctx context.Context, scheme, ref string) (string, error) {
+	secretMu.RLock()
+	provider, ok := secretProviders[scheme]
+	secretMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("config: unknown secret scheme %s", scheme)
+	}
+	value, err := provider.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("resolve secret %s: %w", scheme, err)
+	}
+	return value, nil
+}
+
+// recordSecrets 替换file之前记录的secret，用于Redact
+func recordSecrets(file string, values []string) {
+	secrets := make([]string, 0, len(values))
+	for _, v := range values {
+		if len(v) >= minRedactLength {
+			secrets = append(secrets, v)
+		}
+	}
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	if len(secrets) == 0 {
+		delete(resolvedSecrets, file)
+		return
+	}
+	resolvedSecrets[file] = secrets
+}
+
+// substituteSecrets 将yaml或json中的占位符替换为secret
+// 替换发生在解析之后的字符串节点中，secret包含换行、引号、": "、"#"或者以"*"开头时不会破坏配置的结构
+func substituteSecrets(file string, data []byte, secrets map[string]string, json bool) ([]byte, error) {
+	if len(secrets) == 0 {
+		return data, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	replaceSecrets(&doc, secrets)
+	if !json {
+		return yaml.Marshal(&doc)
+	}
+	var v any
+	if err := doc.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return jsonx.Marshal(v)
+}
+
+func replaceSecrets(node *yaml.Node, secrets map[string]string) {
+	if node.Kind == yaml.ScalarNode {
+		value := node.Value
+		for placeholder, secret := range secrets {
+			value = strings.ReplaceAll(value, placeholder, secret)
+		}
+		if value != node.Value {
+			node.Value, node.Tag, node.Style = value, "!!str", 0
+		}
+	}
+	for _, child := range node.Content {
+		replaceSecrets(child, secrets)
+	}
+}
+
+func resolveFileSecret(ctx context.Context, ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func resolveBase64Secret(ctx context.Context, ref string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ref)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSecret, err)
+	}
+	return string(data), nil
+}
+
+func resolveEnvKeySecret(ctx context.Context, ref string) (string, error) {
+	encoded, ok := os.LookupEnv(SecretKeyEnv)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is not set", ErrInvalidSecret, SecretKeyEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidSecret, SecretKeyEnv, err)
+	}
+	return decryptSecret(key, ref)
+}
+
+func decryptSecret(key []byte, ref string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ref)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", ErrInvalidSecret
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSecret, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func jsonEscape(s string) string {
+	data, err := jsonx.Marshal(s)
+	if err != nil || len(data) < 2 {
+		return s
+	}
+	return string(data[1 : len(data)-1])
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("file-pass\n"), 0o600))
+	key := []byte("0123456789abcdef0123456789abcdef")
+	t.Setenv(SecretKeyEnv, base64.StdEncoding.EncodeToString(key))
+	enc, err := EncryptSecret(key, "enc-pass")
+	assert.NoError(t, err)
+	RegisterSecretProvider("vault", SecretProviderFunc(func(ctx context.Context, ref string) (string, error) {
+		return "vault-" + ref, nil
+	}))
+
+	file := filepath.Join(dir, "app.yaml")
+	content := "a: ${file:" + secretFile + "}\nb: ${base64:YjY0LXBhc3M=}\nc: ${enc:" + enc + "}\nd: ${vault:kv/db}\ne: ${SECRET_TEST_UNSET:-plain}\n"
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	var cfg map[string]string
+	assert.NoError(t, ReadConfig(file, &cfg))
+	assert.Equal(t, map[string]string{"a": "file-pass", "b": "b64-pass", "c": "enc-pass", "d": "vault-kv/db", "e": "plain"}, cfg)
+	assert.Equal(t, `{"a":"******","b":"******","c":"******","d":"******","e":"plain"}`, Redacted(cfg))
+
+	assert.NoError(t, os.WriteFile(file, []byte("a: ${enc:aW52YWxpZA==}\n"), 0o644))
+	assert.ErrorIs(t, ReadConfig(file, &cfg), ErrInvalidSecret)
+}
+
+func TestSecretSubstitution(t *testing.T) {
+	dir := t.TempDir()
+	values := map[string]string{
+		"pem":   "-----BEGIN KEY-----\nMIIB\n-----END KEY-----",
+		"colon": "a: b",
+		"hash":  "p #x",
+		"star":  "*ref",
+	}
+	var yamlContent, jsonContent string
+	for name, value := range values {
+		ref := base64.StdEncoding.EncodeToString([]byte(value))
+		yamlContent += name + ": ${base64:" + ref + "}\n"
+		jsonContent += `,"` + name + `": "prefix-${base64:` + ref + `}"`
+	}
+	yamlFile := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, os.WriteFile(yamlFile, []byte(yamlContent), 0o644))
+	var cfg map[string]string
+	assert.NoError(t, ReadConfig(yamlFile, &cfg))
+	assert.Equal(t, values, cfg)
+
+	jsonFile := filepath.Join(dir, "app.json")
+	assert.NoError(t, os.WriteFile(jsonFile, []byte("{"+jsonContent[1:]+"}"), 0o644))
+	cfg = nil
+	assert.NoError(t, ReadConfig(jsonFile, &cfg))
+	for name, value := range values {
+		assert.Equal(t, "prefix-"+value, cfg[name])
+	}
+}
+
+func TestRedact(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("a: ${base64:b2xkLXBhc3M=}\nb: ${base64:eA==}\n"), 0o644))
+	var cfg map[string]string
+	assert.NoError(t, ReadConfig(file, &cfg))
+	// 过短的secret不隐藏
+	assert.Equal(t, "****** x", Redact("old-pass x"))
+
+	// 重新读取后只保留最新的secret
+	assert.NoError(t, os.WriteFile(file, []byte("a: ${base64:bmV3LXBhc3M=}\n"), 0o644))
+	assert.NoError(t, ReadConfig(file, &cfg))
+	assert.Equal(t, "old-pass ******", Redact("old-pass new-pass"))
+}
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// sensitiveKeyRegexp 名称匹配的配置在Dump和Diff中隐藏
+var sensitiveKeyRegexp = regexp.MustCompile(`(?i)(password|passwd|secret|token|credential|access_?key|private_?key|client_?key)`)
+
+// EffectiveSettings 返回展开环境变量和secret之后实际生效的配置，与ReadConfig的结果一致
+func EffectiveSettings(file string) (map[string]any, error) {
+	v := viper.New()
+	if _, err := readConfigAndExpendEvn(v, file); err != nil {
+		return nil, err
+	}
+	return v.AllSettings(), nil
+}
+
+// MaskSettings 返回隐藏了secret的配置副本，包括名称敏感的配置和通过secret provider解析的值
+func MaskSettings(settings map[string]any) map[string]any {
+	masked := make(map[string]any, len(settings))
+	for k, v := range settings {
+		masked[k] = maskValue(k, v)
+	}
+	return masked
+}
+
+func maskValue(key string, v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		return MaskSettings(value)
+	case []any:
+		items := make([]any, len(value))
+		for i, item := range value {
+			items[i] = maskValue(key, item)
+		}
+		return items
+	case nil:
+		return nil
+	}
+	if sensitiveKeyRegexp.MatchString(key) {
+		return redacted
+	}
+	if s, ok := v.(string); ok {
+		return Redact(s)
+	}
+	return v
+}
+
+// Dump 输出实际生效的配置，secret会被隐藏
+func Dump(file string, format Format) ([]byte, error) {
+	settings, err := EffectiveSettings(file)
+	if err != nil {
+		return nil, err
+	}
+	return Render(MaskSettings(settings), format)
+}
+
+// Render 将配置输出为yaml或json，key按照字母顺序排列
+func Render(settings map[string]any, format Format) ([]byte, error) {
+	switch format {
+	case FormatYAML, "":
+		return yaml.Marshal(settings)
+	case FormatJSON:
+		return json.MarshalIndent(settings, "", "  ")
+	}
+	return nil, fmt.Errorf("config: unsupported format %q", format)
+}
+
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "+"
+	ChangeRemoved  ChangeKind = "-"
+	ChangeModified ChangeKind = "~"
+)
+
+// Change 两个配置之间的一处差异，Old和New已经隐藏了secret
+type Change struct {
+	Kind ChangeKind
+	Path string
+	Old  any
+	New  any
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %v", c.Path, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %v", c.Path, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// Diff 比较两个配置文件实际生效的配置，忽略格式、顺序和注释的差异
+func Diff(oldFile, newFile string) ([]Change, error) {
+	oldSettings, err := EffectiveSettings(oldFile)
+	if err != nil {
+		return nil, err
+	}
+	newSettings, err := EffectiveSettings(newFile)
+	if err != nil {
+		return nil, err
+	}
+	return DiffSettings(oldSettings, newSettings), nil
+}
+
+// DiffSettings 比较两个配置，map递归比较，list和标量整体比较，结果按照路径排序
+// 按照原始值比较，secret的变更也会输出，但Old和New中的secret会被隐藏
+func DiffSettings(oldSettings, newSettings map[string]any) []Change {
+	changes := diffSettings(oldSettings, newSettings, "")
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func diffSettings(oldSettings, newSettings map[string]any, prefix string) []Change {
+	var changes []Change
+	for k, oldValue := range oldSettings {
+		path := joinPath(prefix, k)
+		newValue, ok := newSettings[k]
+		if !ok {
+			changes = append(changes, Change{Kind: ChangeRemoved, Path: path, Old: maskValue(k, oldValue)})
+			continue
+		}
+		oldMap, oldIsMap := oldValue.(map[string]any)
+		newMap, newIsMap := newValue.(map[string]any)
+		if oldIsMap && newIsMap {
+			changes = append(changes, diffSettings(oldMap, newMap, path)...)
+		} else if !equalValue(oldValue, newValue) {
+			changes = append(changes, Change{Kind: ChangeModified, Path: path, Old: maskValue(k, oldValue), New: maskValue(k, newValue)})
+		}
+	}
+	for k, newValue := range newSettings {
+		if _, ok := oldSettings[k]; !ok {
+			changes = append(changes, Change{Kind: ChangeAdded, Path: joinPath(prefix, k), New: maskValue(k, newValue)})
+		}
+	}
+	return changes
+}
+
+// equalValue yaml和json中的数字类型可能不同，例如 1 和 1.0，数字按照数值比较
+func equalValue(a, b any) bool {
+	x, aNumber := toFloat(a)
+	y, bNumber := toFloat(b)
+	if aNumber && bNumber {
+		return x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// ExampleYAML 根据proto生成带注释的示例配置，注释来自proto的注释（需要描述符中带有source info）和字段类型
+func ExampleYAML(desc protoreflect.MessageDescriptor) ([]byte, error) {
+	node := exampleNode(desc, map[protoreflect.FullName]bool{})
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func exampleNode(desc protoreflect.MessageDescriptor, visiting map[protoreflect.FullName]bool) *yaml.Node {
+	if wkt := wellKnownExample(desc); wkt != nil {
+		return wkt
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	if visiting[desc.FullName()] {
+		// 递归的message只展开一层
+		node.Style = yaml.FlowStyle
+		return node
+	}
+	visiting[desc.FullName()] = true
+	defer delete(visiting, desc.FullName())
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: string(fd.Name()), HeadComment: fieldComment(fd)}
+		var value *yaml.Node
+		switch {
+		case fd.IsMap():
+			value = &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+		case fd.IsList():
+			value = &yaml.Node{Kind: yaml.SequenceNode}
+			if fd.Message() != nil {
+				value.Content = append(value.Content, exampleNode(fd.Message(), visiting))
+			} else {
+				value.Style = yaml.FlowStyle
+			}
+		case fd.Message() != nil:
+			value = exampleNode(fd.Message(), visiting)
+		default:
+			value = exampleScalar(fd)
+		}
+		node.Content = append(node.Content, key, value)
+	}
+	return node
+}
+
+func exampleScalar(fd protoreflect.FieldDescriptor) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		node.Tag, node.Value = "!!bool", "false"
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		node.Tag, node.Value = "!!str", ""
+	case protoreflect.EnumKind:
+		node.Tag, node.Value = "!!str", string(fd.Enum().Values().Get(0).Name())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		node.Tag, node.Value = "!!float", "0.0"
+	default:
+		node.Tag, node.Value = "!!int", "0"
+	}
+	return node
+}
+
+func wellKnownExample(desc protoreflect.MessageDescriptor) *yaml.Node {
+	if !isWellKnown(desc) {
+		return nil
+	}
+	switch desc.Name() {
+	case "Duration":
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "0s"}
+	case "Timestamp":
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "1970-01-01T00:00:00Z"}
+	case "Value", "NullValue":
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case "ListValue":
+		return &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+	}
+	if strings.HasSuffix(string(desc.Name()), "Value") && desc.Fields().Len() == 1 {
+		return exampleScalar(desc.Fields().Get(0))
+	}
+	return &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+}
+
+// fieldComment proto中的注释加上字段类型，例如 uint32；enum会列出所有可选值
+func fieldComment(fd protoreflect.FieldDescriptor) string {
+	var lines []string
+	if comment := strings.TrimSpace(fd.ParentFile().SourceLocations().ByDescriptor(fd).LeadingComments); comment != "" {
+		lines = append(lines, strings.Split(comment, "\n")...)
+	}
+	lines = append(lines, fieldType(fd))
+	if fd.Enum() != nil {
+		values := fd.Enum().Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		lines = append(lines, "one of: "+strings.Join(names, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func fieldType(fd protoreflect.FieldDescriptor) string {
+	name := fd.Kind().String()
+	switch {
+	case fd.IsMap():
+		return fmt.Sprintf("map<%s, %s>", fd.MapKey().Kind(), fieldType(fd.MapValue()))
+	case fd.Message() != nil:
+		name = string(fd.Message().FullName())
+	case fd.Enum() != nil:
+		name = string(fd.Enum().FullName())
+	}
+	if fd.IsList() {
+		return "repeated " + name
+	}
+	return name
+}
+
+// JSONSchema 根据proto生成JSON Schema(draft 2020-12)，可以用于编辑器对yaml配置的补全和校验
+// 字段名使用proto中的名称，未知字段不允许出现
+func JSONSchema(desc protoreflect.MessageDescriptor) ([]byte, error) {
+	defs := map[string]any{}
+	schema := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   string(desc.FullName()),
+	}
+	for k, v := range messageSchema(desc, defs) {
+		schema[k] = v
+	}
+	if len(defs) > 0 {
+		schema["$defs"] = defs
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func messageSchema(desc protoreflect.MessageDescriptor, defs map[string]any) map[string]any {
+	if isWellKnown(desc) {
+		return wellKnownSchema(desc)
+	}
+	properties := map[string]any{}
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		var schema map[string]any
+		switch {
+		case fd.IsMap():
+			schema = map[string]any{"type": "object", "additionalProperties": valueSchema(fd.MapValue(), defs)}
+		case fd.IsList():
+			schema = map[string]any{"type": "array", "items": valueSchema(fd, defs)}
+		default:
+			schema = valueSchema(fd, defs)
+		}
+		if comment := strings.TrimSpace(fd.ParentFile().SourceLocations().ByDescriptor(fd).LeadingComments); comment != "" {
+			schema["description"] = comment
+		}
+		properties[string(fd.Name())] = schema
+	}
+	return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// valueSchema 单个值的schema，message放到$defs中引用以支持递归
+func valueSchema(fd protoreflect.FieldDescriptor, defs map[string]any) map[string]any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		msg := fd.Message()
+		if isWellKnown(msg) {
+			return wellKnownSchema(msg)
+		}
+		name := string(msg.FullName())
+		if _, ok := defs[name]; !ok {
+			defs[name] = nil
+			defs[name] = messageSchema(msg, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		enum := make([]any, 0, values.Len())
+		for i := 0; i < values.Len(); i++ {
+			enum = append(enum, string(values.Get(i).Name()))
+		}
+		return map[string]any{"enum": enum}
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return map[string]any{"type": "string"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]any{"type": "number"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson中64位整数可以是数字或者字符串
+		return map[string]any{"type": []string{"integer", "string"}}
+	}
+	return map[string]any{"type": "integer"}
+}
+
+func wellKnownSchema(desc protoreflect.MessageDescriptor) map[string]any {
+	switch desc.Name() {
+	case "Duration":
+		return map[string]any{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`}
+	case "Timestamp":
+		return map[string]any{"type": "string", "format": "date-time"}
+	case "Struct":
+		return map[string]any{"type": "object"}
+	case "ListValue":
+		return map[string]any{"type": "array"}
+	case "Value", "Any":
+		return map[string]any{}
+	}
+	if strings.HasSuffix(string(desc.Name()), "Value") && desc.Fields().Len() == 1 {
+		return valueSchema(desc.Fields().Get(0), nil)
+	}
+	return map[string]any{}
+}
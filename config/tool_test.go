@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpAndDiff(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.yaml")
+	newFile := filepath.Join(dir, "new.yaml")
+	assert.NoError(t, os.WriteFile(oldFile, []byte("db:\n  host: ${TOOL_DB_HOST:-localhost}\n  password: p@ss\n  port: 3306\nlog: info\n"), 0o644))
+	assert.NoError(t, os.WriteFile(newFile, []byte("{\"db\": {\"port\": 3307, \"host\": \"localhost\", \"password\": \"other\"}, \"debug\": true}"), 0o644))
+
+	data, err := Dump(oldFile, FormatYAML)
+	assert.NoError(t, err)
+	assert.Equal(t, "db:\n    host: localhost\n    password: '******'\n    port: 3306\nlog: info\n", string(data))
+
+	changes, err := Diff(oldFile, newFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Kind: ChangeModified, Path: "db.password", Old: redacted, New: redacted},
+		{Kind: ChangeModified, Path: "db.port", Old: 3306, New: 3307},
+		{Kind: ChangeAdded, Path: "debug", New: true},
+		{Kind: ChangeRemoved, Path: "log", Old: "info"},
+	}, changes)
+}
+
+func TestExampleAndSchema(t *testing.T) {
+	desc := newTestMessage(t).Descriptor()
+
+	data, err := ExampleYAML(desc)
+	assert.NoError(t, err)
+	assert.Equal(t, "# string\nname: \"\"\n# repeated test.v1.Server\nservers:\n  - # string\n    host: \"\"\n    # int32\n    port: 0\n# int32\nmax_idle_conns: 0\n", string(data))
+
+	data, err = JSONSchema(desc)
+	assert.NoError(t, err)
+	var schema map[string]any
+	assert.NoError(t, json.Unmarshal(data, &schema))
+	assert.Equal(t, map[string]any{"type": "array", "items": map[string]any{"$ref": "#/$defs/test.v1.Server"}},
+		schema["properties"].(map[string]any)["servers"])
+	assert.Contains(t, schema["$defs"], "test.v1.Server")
+}
@@ -0,0 +1,373 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"buf.build/go/protovalidate"
+	"go.yaml.in/yaml/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	protojsonPosition = regexp.MustCompile(`\(line \d+:\d+\): `)
+	protojsonField    = regexp.MustCompile(`field (\w+)`)
+)
+
+// ProtoValidator 使用protovalidate校验proto中定义的buf.validate规则，通过WithValidator(ProtoValidator)开启
+var ProtoValidator Validator = ValidatorFunc(func(msg proto.Message) error {
+	return protovalidate.Validate(msg)
+})
+
+// Validator 校验解析后的proto配置
+// 返回protovalidate.ValidationError时，每个违反的规则都会定位到配置文件的行号
+type Validator interface {
+	Validate(msg proto.Message) error
+}
+
+// ValidatorFunc 将函数转换为Validator
+type ValidatorFunc func(msg proto.Message) error
+
+func (f ValidatorFunc) Validate(msg proto.Message) error {
+	return f(msg)
+}
+
+type ProtoOpts struct {
+	// DisallowUnknown 配置文件中存在proto中没有的字段时返回错误，默认忽略
+	DisallowUnknown bool
+	// Validator 解析完成后校验配置，默认不校验，参考ProtoValidator
+	Validator Validator
+}
+
+type ProtoOption func(o *ProtoOpts)
+
+// WithDisallowUnknown : 配置文件中存在未知字段时返回错误
+func WithDisallowUnknown() ProtoOption {
+	return func(o *ProtoOpts) {
+		o.DisallowUnknown = true
+	}
+}
+
+// WithValidator : 设置配置校验，例如WithValidator(ProtoValidator)，v为nil时不校验
+func WithValidator(v Validator) ProtoOption {
+	return func(o *ProtoOpts) {
+		o.Validator = v
+	}
+}
+
+// Violation 配置中的一个错误，Line为0时表示无法定位到行
+type Violation struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	pos := v.File
+	if v.Line > 0 {
+		pos = fmt.Sprintf("%s:%d:%d", v.File, v.Line, v.Column)
+	}
+	if v.Path == "" {
+		return fmt.Sprintf("%s: %s", pos, v.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", pos, v.Path, v.Message)
+}
+
+// ValidationError 汇总了配置中所有的错误
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Violations)+1)
+	lines = append(lines, fmt.Sprintf("config: %d violation(s)", len(e.Violations)))
+	for _, v := range e.Violations {
+		lines = append(lines, "  "+v.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// configNodes 配置文件的yaml节点，用于定位字段所在的行
+type configNodes struct {
+	file   string
+	root   *yaml.Node
+	folded bool // key已经被viper转换为小写，无法得到原始的key
+	nodes  map[string]*yaml.Node
+	fields map[string]protoreflect.FieldDescriptor
+}
+
+// parseConfigNodes 只有yaml和json文件可以定位到行，其他格式以及expanded为nil（例如多层合并的配置）时返回的节点没有位置信息
+func parseConfigNodes(file string, expanded []byte, settings map[string]any) (*configNodes, error) {
+	var doc yaml.Node
+	folded := false
+	switch ext := strings.ToLower(filepath.Ext(file)); {
+	case expanded != nil && (ext == ".yaml" || ext == ".yml" || ext == ".json"):
+		if err := yaml.Unmarshal(expanded, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	default:
+		if err := doc.Encode(settings); err != nil {
+			return nil, err
+		}
+		clearPositions(&doc)
+		folded = true
+	}
+	root := &doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	return &configNodes{
+		file:   file,
+		root:   root,
+		folded: folded,
+		nodes:  map[string]*yaml.Node{},
+		fields: map[string]protoreflect.FieldDescriptor{},
+	}, nil
+}
+
+func clearPositions(node *yaml.Node) {
+	node.Line, node.Column = 0, 0
+	for _, child := range node.Content {
+		clearPositions(child)
+	}
+}
+
+// checkUnknown 按照proto的结构遍历yaml，记录每个字段的节点并收集未知字段
+func (c *configNodes) checkUnknown(node *yaml.Node, desc protoreflect.MessageDescriptor, path string, unknown bool) []Violation {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yaml.MappingNode || isWellKnown(desc) {
+		return nil
+	}
+	var violations []Violation
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveAlias(node.Content[i+1])
+		if key.Value == "<<" {
+			continue
+		}
+		field := lookupField(desc, key.Value, c.folded)
+		if field == nil {
+			if unknown {
+				violations = append(violations, c.violation(key, joinPath(path, key.Value), "unknown field"))
+			}
+			continue
+		}
+		fieldPath := joinPath(path, string(field.Name()))
+		c.nodes[fieldPath] = value
+		c.fields[fieldPath] = field
+		switch {
+		case field.IsMap():
+			if value.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				entryPath := fieldPath + mapSubscript(field.MapKey().Kind(), value.Content[j].Value)
+				c.nodes[entryPath] = value.Content[j+1]
+				if field.MapValue().Message() != nil {
+					violations = append(violations, c.checkUnknown(value.Content[j+1], field.MapValue().Message(), entryPath, unknown)...)
+				}
+			}
+		case field.IsList():
+			if value.Kind != yaml.SequenceNode {
+				continue
+			}
+			for j, item := range value.Content {
+				itemPath := fmt.Sprintf("%s[%d]", fieldPath, j)
+				c.nodes[itemPath] = item
+				if field.Message() != nil {
+					violations = append(violations, c.checkUnknown(item, field.Message(), itemPath, unknown)...)
+				}
+			}
+		case field.Message() != nil:
+			violations = append(violations, c.checkUnknown(value, field.Message(), fieldPath, unknown)...)
+		}
+	}
+	return violations
+}
+
+// locate 返回最接近path的节点，字段缺失时定位到父节点
+func (c *configNodes) locate(path string) *yaml.Node {
+	for path != "" {
+		if node, ok := c.nodes[path]; ok {
+			return node
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return c.root
+}
+
+func (c *configNodes) violation(node *yaml.Node, path, message string) Violation {
+	v := Violation{File: c.file, Path: path, Message: message}
+	if node != nil {
+		v.Line, v.Column = node.Line, node.Column
+	}
+	return v
+}
+
+// validationViolations 展开Validator返回的错误，protovalidate.ValidationError中的每个违反的规则定位到对应的行
+func (c *configNodes) validationViolations(err error) []Violation {
+	var verr *protovalidate.ValidationError
+	if !errors.As(err, &verr) {
+		return []Violation{c.violation(nil, "", err.Error())}
+	}
+	var violations []Violation
+	for _, v := range verr.ToProto().GetViolations() {
+		path := fieldPathString(v.GetField())
+		message := v.GetMessage()
+		if message == "" {
+			message = v.GetRuleId()
+		}
+		violations = append(violations, c.violation(c.locate(path), path, message))
+	}
+	return violations
+}
+
+// unmarshalViolation 根据protojson错误中的字段名定位到行
+// protojson的错误中的行号是内部生成的json中的位置，对配置文件没有意义，这里去掉
+func (c *configNodes) unmarshalViolation(err error) Violation {
+	message := protojsonPosition.ReplaceAllString(strings.TrimPrefix(err.Error(), "proto: "), "")
+	m := protojsonField.FindStringSubmatch(message)
+	if m == nil {
+		return c.violation(nil, "", message)
+	}
+	var paths []string
+	for path, field := range c.fields {
+		if field.JSONName() == m[1] || string(field.Name()) == m[1] {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return c.violation(nil, "", message)
+	}
+	// 同名的字段出现在多处时无法确定是哪一个，取第一个
+	sort.Strings(paths)
+	return c.violation(c.nodes[paths[0]], paths[0], message)
+}
+
+// fieldPathString 将buf.validate.FieldPath转换为 a.b[0].c["key"] 形式
+func fieldPathString(fieldPath *validate.FieldPath) string {
+	var b strings.Builder
+	for i, element := range fieldPath.GetElements() {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(element.GetFieldName())
+		switch subscript := element.GetSubscript().(type) {
+		case *validate.FieldPathElement_Index:
+			b.WriteString(fmt.Sprintf("[%d]", subscript.Index))
+		case *validate.FieldPathElement_BoolKey:
+			b.WriteString(fmt.Sprintf("[%t]", subscript.BoolKey))
+		case *validate.FieldPathElement_IntKey:
+			b.WriteString(fmt.Sprintf("[%d]", subscript.IntKey))
+		case *validate.FieldPathElement_UintKey:
+			b.WriteString(fmt.Sprintf("[%d]", subscript.UintKey))
+		case *validate.FieldPathElement_StringKey:
+			b.WriteString("[" + strconv.Quote(subscript.StringKey) + "]")
+		}
+	}
+	return b.String()
+}
+
+// lookupField key必须与字段名或者json名完全相同，例如max_idle_conns和maxIdleConns，MaxIdleConns是未知字段
+// folded为true时key已经被转换为小写，与小写的字段名或者json名比较
+func lookupField(desc protoreflect.MessageDescriptor, key string, folded bool) protoreflect.FieldDescriptor {
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name, jsonName := string(fd.Name()), fd.JSONName()
+		if folded {
+			name, jsonName = strings.ToLower(name), strings.ToLower(jsonName)
+		}
+		if key == name || key == jsonName {
+			return fd
+		}
+	}
+	return nil
+}
+
+// normalizeKeys viper会将key转换为小写，protojson无法识别小写后的json名（例如maxidleconns），这里改为字段名
+func normalizeKeys(settings map[string]any, desc protoreflect.MessageDescriptor) map[string]any {
+	if isWellKnown(desc) {
+		return settings
+	}
+	normalized := make(map[string]any, len(settings))
+	for k, v := range settings {
+		field := lookupField(desc, strings.ToLower(k), true)
+		if field == nil {
+			normalized[k] = v
+			continue
+		}
+		normalized[string(field.Name())] = normalizeValue(v, field)
+	}
+	return normalized
+}
+
+func normalizeValue(v any, field protoreflect.FieldDescriptor) any {
+	switch {
+	case field.IsMap():
+		m, ok := v.(map[string]any)
+		if !ok || field.MapValue().Message() == nil {
+			return v
+		}
+		entries := make(map[string]any, len(m))
+		for k, item := range m {
+			if item, ok := item.(map[string]any); ok {
+				entries[k] = normalizeKeys(item, field.MapValue().Message())
+				continue
+			}
+			entries[k] = item
+		}
+		return entries
+	case field.Message() == nil:
+		return v
+	case field.IsList():
+		list, ok := v.([]any)
+		if !ok {
+			return v
+		}
+		items := make([]any, len(list))
+		for i, item := range list {
+			if m, ok := item.(map[string]any); ok {
+				item = normalizeKeys(m, field.Message())
+			}
+			items[i] = item
+		}
+		return items
+	default:
+		if m, ok := v.(map[string]any); ok {
+			return normalizeKeys(m, field.Message())
+		}
+		return v
+	}
+}
+
+func mapSubscript(kind protoreflect.Kind, key string) string {
+	if kind == protoreflect.StringKind {
+		return "[" + strconv.Quote(key) + "]"
+	}
+	return "[" + key + "]"
+}
+
+// isWellKnown google.protobuf中的类型（Struct、Duration等）在json中不是按照字段表示的
+func isWellKnown(desc protoreflect.MessageDescriptor) bool {
+	return desc.ParentFile() != nil && desc.ParentFile().Package() == "google.protobuf"
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const testDescriptor = `
+name: "test.proto" package: "test.v1" syntax: "proto3"
+dependency: "buf/validate/validate.proto"
+message_type {
+  name: "Config"
+  field { name: "name" number: 1 type: TYPE_STRING label: LABEL_OPTIONAL json_name: "name" }
+  field { name: "servers" number: 2 type: TYPE_MESSAGE type_name: ".test.v1.Server" label: LABEL_REPEATED json_name: "servers" }
+  field { name: "max_idle_conns" number: 3 type: TYPE_INT32 label: LABEL_OPTIONAL json_name: "maxIdleConns" }
+}
+message_type {
+  name: "Server"
+  field { name: "host" number: 1 type: TYPE_STRING label: LABEL_OPTIONAL json_name: "host" }
+  field {
+    name: "port" number: 2 type: TYPE_INT32 label: LABEL_OPTIONAL json_name: "port"
+    options { [buf.validate.field] { required: true } }
+  }
+}`
+
+func newTestMessage(t *testing.T) *dynamicpb.Message {
+	fdp := &descriptorpb.FileDescriptorProto{}
+	assert.NoError(t, prototext.Unmarshal([]byte(testDescriptor), fdp))
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	assert.NoError(t, err)
+	return dynamicpb.NewMessage(fd.Messages().ByName(protoreflect.Name("Config")))
+}
+
+func TestReadProtoConfigValidate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: app\nservers:\n  - host: a\n    prot: 80\n  - host: b\nnmae: typo\n"), 0o644))
+
+	// 默认不校验
+	assert.NoError(t, ReadProtoConfig(file, newTestMessage(t)))
+
+	err := ReadProtoConfig(file, newTestMessage(t), WithDisallowUnknown(), WithValidator(ProtoValidator))
+	var verr *ValidationError
+	assert.True(t, errors.As(err, &verr))
+	assert.Equal(t, []Violation{
+		{File: file, Line: 4, Column: 5, Path: "servers[0].prot", Message: "unknown field"},
+		{File: file, Line: 6, Column: 1, Path: "nmae", Message: "unknown field"},
+		{File: file, Line: 3, Column: 5, Path: "servers[0].port", Message: "value is required"},
+		{File: file, Line: 5, Column: 5, Path: "servers[1].port", Message: "value is required"},
+	}, verr.Violations)
+}
+
+func TestReadProtoConfigUnmarshalError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: app\nservers:\n  - host: a\n    port: abc\n"), 0o644))
+
+	err := ReadProtoConfig(file, newTestMessage(t))
+	var verr *ValidationError
+	assert.True(t, errors.As(err, &verr))
+	assert.Len(t, verr.Violations, 1)
+	assert.Equal(t, 4, verr.Violations[0].Line)
+	assert.Equal(t, "servers[0].port", verr.Violations[0].Path)
+	assert.NotContains(t, verr.Violations[0].Message, "(line")
+}
+
+func TestReadProtoConfigCamelCase(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: app\nmaxIdleConns: 5\n"), 0o644))
+	msg := newTestMessage(t)
+	assert.NoError(t, ReadProtoConfig(file, msg, WithDisallowUnknown()))
+	field := msg.Descriptor().Fields().ByName("max_idle_conns")
+	assert.Equal(t, int64(5), msg.Get(field).Int())
+
+	// 大小写与字段名和json名都不相同时是未知字段
+	assert.NoError(t, os.WriteFile(file, []byte("name: app\nMaxIdleConns: 5\n"), 0o644))
+	err := ReadProtoConfig(file, newTestMessage(t), WithDisallowUnknown())
+	var verr *ValidationError
+	assert.True(t, errors.As(err, &verr))
+	assert.Equal(t, []Violation{
+		{File: file, Line: 2, Column: 1, Path: "MaxIdleConns", Message: "unknown field"},
+	}, verr.Violations)
+}
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultWatchDebounce = 200 * time.Millisecond
+
+// Subscriber 配置变更的回调，old为变更前的配置，new为变更后的配置
+// 回调中不能修改配置
+type Subscriber[T proto.Message] func(old, new T)
+
+type WatcherOpts[T proto.Message] struct {
+	// Validate 校验新的配置，返回错误时放弃本次变更，继续使用当前配置
+	Validate func(msg T) error
+	// OnError 重新加载失败时的回调，默认使用标准库log输出
+	OnError func(err error)
+	// Debounce 文件变更后等待的时间，编辑器保存时可能触发多次事件，默认200ms
+	Debounce time.Duration
+	// Remote 远程配置，合并到文件配置之上，参考WithRemote
+	Remote RemoteSource
+	// Snapshot 远程配置的本地快照文件
+	Snapshot string
+	// ProtoOptions 解析配置的选项，例如WithValidator(ProtoValidator)，参考ReadProtoConfig
+	ProtoOptions []ProtoOption
+}
+
+type WatcherOption[T proto.Message] func(o *WatcherOpts[T])
+
+// WithValidate : 设置配置校验函数
+func WithValidate[T proto.Message](validate func(msg T) error) WatcherOption[T] {
+	return func(o *WatcherOpts[T]) {
+		o.Validate = validate
+	}
+}
+
+// WithOnError : 设置重新加载失败时的回调
+func WithOnError[T proto.Message](onError func(err error)) WatcherOption[T] {
+	return func(o *WatcherOpts[T]) {
+		o.OnError = onError
+	}
+}
+
+// WithProtoOptions : 设置解析配置的选项，例如WithDisallowUnknown、WithValidator
+func WithProtoOptions[T proto.Message](options ...ProtoOption) WatcherOption[T] {
+	return func(o *WatcherOpts[T]) {
+		o.ProtoOptions = append(o.ProtoOptions, options...)
+	}
+}
+
+// WithDebounce : 设置文件变更后等待的时间
+func WithDebounce[T proto.Message](d time.Duration) WatcherOption[T] {
+	return func(o *WatcherOpts[T]) {
+		o.Debounce = d
+	}
+}
+
+// Watcher 监听配置文件变更并热加载
+// 文件变更后重新展开环境变量、解析为新的proto结构并校验，校验通过后原子替换并通知订阅者
+// 解析或者校验失败时保留当前配置
+// 实现了signalx.SignalHandler，可以直接注册到SignalListener
+type Watcher[T proto.Message] struct {
+	file   string
+	newMsg func() T
+	opts   *WatcherOpts[T]
+	value  atomic.Pointer[T]
+	remote atomic.Pointer[map[string]any] // 最后一次读取成功的远程配置
+
+	reloadMu    sync.Mutex // 保证reload串行执行，包括读取配置和通知订阅者
+	mu          sync.Mutex // 保护subscribers
+	subscribers map[uint64]Subscriber[T]
+	nextID      uint64
+
+	lifecycle    sync.Mutex
+	watcher      *fsnotify.Watcher
+	done         chan struct{}
+	remoteCancel context.CancelFunc
+	remoteDone   chan struct{}
+}
+
+// NewWatcher 读取配置文件并创建Watcher，newMsg用于创建新的proto结构
+// 首次读取或者校验失败时返回错误
+func NewWatcher[T proto.Message](file string, newMsg func() T, options ...WatcherOption[T]) (*Watcher[T], error) {
+	opts := &WatcherOpts[T]{
+		Debounce: defaultWatchDebounce,
+		OnError: func(err error) {
+			log.Printf("[config] reload failed: %v", err)
+		},
+	}
+	for _, op := range options {
+		op(opts)
+	}
+	w := &Watcher[T]{
+		file:        file,
+		newMsg:      newMsg,
+		opts:        opts,
+		subscribers: make(map[uint64]Subscriber[T]),
+	}
+	msg, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.value.Store(&msg)
+	return w, nil
+}
+
+// Get 返回当前配置，返回的配置是只读的
+func (w *Watcher[T]) Get() T {
+	return *w.value.Load()
+}
+
+// Subscribe 订阅配置变更，返回取消订阅的函数
+// 回调在Watcher的goroutine中串行执行，耗时的操作需要自行异步处理
+// 回调中可以取消订阅，但不能调用Reload
+func (w *Watcher[T]) Subscribe(fn Subscriber[T]) (cancel func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.nextID
+	w.nextID++
+	w.subscribers[id] = fn
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subscribers, id)
+	}
+}
+
+// Reload 立即重新加载配置，配置没有变化时不通知订阅者
+func (w *Watcher[T]) Reload() error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	msg, err := w.load()
+	if err != nil {
+		return err
+	}
+	old := w.Get()
+	if proto.Equal(old, msg) {
+		return nil
+	}
+	w.value.Store(&msg)
+	w.mu.Lock()
+	subscribers := make([]Subscriber[T], 0, len(w.subscribers))
+	for _, fn := range w.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	w.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(old, msg)
+	}
+	return nil
+}
+
+func (w *Watcher[T]) load() (T, error) {
+	msg := w.newMsg()
+	if err := w.read(msg); err != nil {
+		var zero T
+		return zero, err
+	}
+	if w.opts.Validate != nil {
+		if err := w.opts.Validate(msg); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+	return msg, nil
+}
+
+func (w *Watcher[T]) read(msg T) error {
+	if w.opts.Remote == nil {
+		return ReadProtoConfig(w.file, msg, w.opts.ProtoOptions...)
+	}
+	v := viper.New()
+	expanded, err := readConfigAndExpendEvn(v, w.file)
+	if err != nil {
+		return err
+	}
+	remote, err := w.loadRemote()
+	if err != nil {
+		return err
+	}
+	settings := v.AllSettings()
+	mergeSettings(settings, remote, "", layerRemote, Explain{})
+	return decodeProto(w.file, expanded, settings, msg, w.opts.ProtoOptions...)
+}
+
+// Start 开始监听配置文件（非阻塞），监听失败时通过OnError返回
+func (w *Watcher[T]) Start() {
+	if err := w.Watch(); err != nil {
+		w.opts.OnError(err)
+	}
+}
+
+// Watch 开始监听配置文件（非阻塞），设置了远程配置时同时监听远程配置
+// 监听的是文件所在的目录，可以处理编辑器和k8s ConfigMap通过rename/symlink替换文件的情况
+func (w *Watcher[T]) Watch() error {
+	w.lifecycle.Lock()
+	defer w.lifecycle.Unlock()
+	if w.watcher != nil {
+		return nil
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := fw.Add(filepath.Dir(w.file)); err != nil {
+		_ = fw.Close()
+		return err
+	}
+	w.watcher = fw
+	w.done = make(chan struct{})
+	go w.run(fw, w.done)
+	if w.opts.Remote != nil {
+		var ctx context.Context
+		ctx, w.remoteCancel = context.WithCancel(context.Background())
+		w.remoteDone = make(chan struct{})
+		go w.watchRemote(ctx, w.remoteDone)
+	}
+	return nil
+}
+
+// Stop 停止监听
+func (w *Watcher[T]) Stop() {
+	w.lifecycle.Lock()
+	fw, done := w.watcher, w.done
+	remoteCancel, remoteDone := w.remoteCancel, w.remoteDone
+	w.watcher, w.done = nil, nil
+	w.remoteCancel, w.remoteDone = nil, nil
+	w.lifecycle.Unlock()
+	if fw == nil {
+		return
+	}
+	_ = fw.Close()
+	<-done
+	if remoteCancel != nil {
+		remoteCancel()
+		<-remoteDone
+	}
+}
+
+func (w *Watcher[T]) run(fw *fsnotify.Watcher, done chan struct{}) {
+	defer close(done)
+	file := filepath.Clean(w.file)
+	realFile, _ := filepath.EvalSymlinks(file)
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case event, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+			current, _ := filepath.EvalSymlinks(file)
+			changed := filepath.Clean(event.Name) == file ||
+				(event.Has(fsnotify.Create) || event.Has(fsnotify.Write)) && current != "" && current != realFile
+			if !changed || !(event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename)) {
+				continue
+			}
+			realFile = current
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(w.opts.Debounce, func() {
+				if err := w.Reload(); err != nil {
+					w.opts.OnError(err)
+				}
+			})
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.opts.OnError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("level: info\n"), 0o644))
+	t.Setenv("WATCH_LEVEL", "debug")
+
+	w, err := NewWatcher(file, func() *structpb.Struct { return &structpb.Struct{} },
+		WithValidate(func(msg *structpb.Struct) error {
+			if msg.Fields["level"].GetStringValue() == "" {
+				return errors.New("level is required")
+			}
+			return nil
+		}),
+		WithDebounce[*structpb.Struct](10*time.Millisecond),
+		WithOnError[*structpb.Struct](func(err error) {}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "info", w.Get().Fields["level"].GetStringValue())
+
+	changes := make(chan [2]string, 10)
+	w.Subscribe(func(old, new *structpb.Struct) {
+		changes <- [2]string{old.Fields["level"].GetStringValue(), new.Fields["level"].GetStringValue()}
+	})
+	assert.NoError(t, w.Watch())
+	defer w.Stop()
+
+	assert.NoError(t, os.WriteFile(file, []byte("level: ${WATCH_LEVEL:-warn}\n"), 0o644))
+	select {
+	case change := <-changes:
+		assert.Equal(t, [2]string{"info", "debug"}, change)
+	case <-time.After(3 * time.Second):
+		t.Fatal("no change notified")
+	}
+
+	// 校验失败时保留当前配置
+	assert.NoError(t, os.WriteFile(file, []byte("level: ''\n"), 0o644))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "debug", w.Get().Fields["level"].GetStringValue())
+	assert.Error(t, w.Reload())
+}
+
+func TestWatcher_UnsubscribeInCallback(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("level: info\n"), 0o644))
+	w, err := NewWatcher(file, func() *structpb.Struct { return &structpb.Struct{} })
+	assert.NoError(t, err)
+
+	var calls int
+	var cancel func()
+	cancel = w.Subscribe(func(old, new *structpb.Struct) {
+		calls++
+		cancel()
+	})
+	assert.NoError(t, os.WriteFile(file, []byte("level: debug\n"), 0o644))
+	assert.NoError(t, w.Reload())
+	assert.NoError(t, os.WriteFile(file, []byte("level: warn\n"), 0o644))
+	assert.NoError(t, w.Reload())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "warn", w.Get().Fields["level"].GetStringValue())
+}
@@ -3,6 +3,10 @@ package ecode
 import (
 	"errors"
 	"fmt"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
 )
 
 var (
@@ -14,37 +18,160 @@ type Codes interface {
 	Error() string       // 返回详细错误信息
 	Code() uint32        // 返回错误码
 	Message() string     // 返回错误的说明信息
-	AddDetail(err error) // 添加底层错误信息
+	AddDetail(err error) // Deprecated: 使用Code.WithDetail，对NewCode返回的错误码不生效
 }
 
+// Code NewCode注册的错误码是不可变的模板，WithDetail、Wrap、WithMessagef、WithParams返回新的实例
+// 实例与模板的错误码相同时errors.Is返回true，例如 errors.Is(err, ErrUserNotFound)
+// 只有Codes时可以通过errors.As取得*Code
 type Code struct {
-	ErrCode uint32 // 错误代码
-	ErrMsg  string // 错误信息
-	Detail  error  // 保存内部错误，主要用于日志，不向前端暴露
+	ErrCode    uint32 // 错误代码
+	ErrMsg     string // 错误信息
+	Detail     error  // 保存内部错误，主要用于日志，不向前端暴露
+	status     *CodeOpts
+	registered bool      // NewCode注册的模板，不能修改
+	stack      []uintptr // 创建实例时的调用栈，参考EnableStack
+	params     any       // 错误信息的模板参数，参考WithParams
+	custom     bool      // 通过WithMessagef设置了错误信息，不再翻译
+}
+
+type CodeOpts struct {
+	// HTTPStatus 返回给http客户端的状态码，未设置时根据GRPCCode推导，都未设置时为500
+	HTTPStatus int
+	// GRPCCode 返回给grpc客户端的状态码，未设置时根据HTTPStatus推导，都未设置时为codes.Unknown
+	GRPCCode codes.Code
+	// FallbackMessage 错误信息是模板并且缺少参数时使用的信息，未设置时使用http状态码的说明
+	FallbackMessage string
+}
+
+type CodeOption func(o *CodeOpts)
+
+// WithHTTPStatus : 设置错误码对应的http状态码
+func WithHTTPStatus(status int) CodeOption {
+	return func(o *CodeOpts) {
+		o.HTTPStatus = status
+	}
+}
+
+// WithGRPCCode : 设置错误码对应的grpc状态码
+func WithGRPCCode(code codes.Code) CodeOption {
+	return func(o *CodeOpts) {
+		o.GRPCCode = code
+	}
+}
+
+// WithFallbackMessage : 设置错误信息缺少模板参数时使用的信息，例如 "too many requests"
+func WithFallbackMessage(msg string) CodeOption {
+	return func(o *CodeOpts) {
+		o.FallbackMessage = msg
+	}
 }
 
 // NewCode : 非业务错误码小于0， 业务代码大于0
-func NewCode(errCode uint32, errMsg string) Codes {
-	return add(errCode, errMsg)
+func NewCode(errCode uint32, errMsg string, options ...CodeOption) *Code {
+	opts := &CodeOpts{}
+	for _, op := range options {
+		op(opts)
+	}
+	code := add(errCode, errMsg)
+	code.status = opts
+	return code
 }
 
+// Message 返回错误信息，错误信息是模板并且缺少参数时，返回WithFallbackMessage设置的信息或者http状态码的说明
 func (c *Code) Message() string {
-	if len(c.ErrMsg) > 0 {
+	// WithMessagef的信息可能包含用户输入，不作为模板渲染
+	if c.custom {
 		return c.ErrMsg
 	}
-	return _codes[c.ErrCode].ErrMsg
+	msg := c.ErrMsg
+	registered, isRegistered := _codes[c.ErrCode]
+	if msg == "" && isRegistered {
+		msg = registered.ErrMsg
+	}
+	if rendered, ok := renderMessage(msg, c.params); ok {
+		return rendered
+	}
+	// 缺少模板参数时不返回残缺的信息
+	if isRegistered && registered.status != nil && registered.status.FallbackMessage != "" {
+		return registered.status.FallbackMessage
+	}
+	return http.StatusText(HTTPStatus(c))
 }
 
 func (c *Code) Code() uint32 {
 	return c.ErrCode
 }
 
+// AddDetail 直接修改当前实例，FromCode、FromMsg返回的是副本，可以修改
+// NewCode返回的错误码是共享的，修改会泄露到其他请求中，因此不生效并输出日志
+//
+// Deprecated: 使用WithDetail
 func (c *Code) AddDetail(err error) {
-	if c.Detail == nil {
-		c.Detail = err
-	} else {
-		c.Detail = fmt.Errorf("%w; %s", c.Detail, err.Error())
+	if err == nil {
+		return
 	}
+	if c.registered {
+		log.Printf("[ecode] AddDetail on registered code %d is ignored, use WithDetail instead: %v", c.ErrCode, err)
+		return
+	}
+	c.Detail = joinDetail(c.Detail, err)
+}
+
+// WithDetail 返回追加了底层错误信息的新实例，不修改当前实例
+func (c *Code) WithDetail(err error) *Code {
+	n := c.clone()
+	if err != nil {
+		n.Detail = joinDetail(n.Detail, err)
+	}
+	return n
+}
+
+// Wrap 返回以err为底层错误的新实例，可以通过errors.Is/As判断底层错误
+// 与WithDetail一样追加到已有的底层错误之后，不会覆盖
+func (c *Code) Wrap(err error) *Code {
+	return c.WithDetail(err)
+}
+
+// WithMessagef 返回使用新错误信息的新实例，错误码不变
+func (c *Code) WithMessagef(format string, args ...any) *Code {
+	n := c.clone()
+	n.ErrMsg = fmt.Sprintf(format, args...)
+	n.custom = true
+	return n
+}
+
+func (c *Code) Unwrap() error {
+	return c.Detail
+}
+
+// Is 错误码相同时返回true
+func (c *Code) Is(target error) bool {
+	t, ok := target.(*Code)
+	return ok && t.ErrCode == c.ErrCode
+}
+
+func (c *Code) clone() *Code {
+	n := &Code{
+		ErrCode: c.ErrCode,
+		ErrMsg:  c.ErrMsg,
+		Detail:  c.Detail,
+		status:  c.status,
+		stack:   c.stack,
+		params:  c.params,
+		custom:  c.custom,
+	}
+	if n.stack == nil && captureStack.Load() {
+		n.stack = callers()
+	}
+	return n
+}
+
+func joinDetail(detail, err error) error {
+	if detail == nil {
+		return err
+	}
+	return fmt.Errorf("%w; %w", detail, err)
 }
 
 func (c *Code) Error() string {
@@ -65,20 +192,24 @@ func IsCodes(err error) (Codes, bool) {
 	return nil, false
 }
 
+// FromCode 返回错误码对应的新实例，可以通过AddDetail修改
 func FromCode(code uint32) Codes {
 	c, ok := _codes[code]
 	if !ok {
 		return nil
 	}
-	return c
+	return c.clone()
 }
 
+// FromMsg 根据NewCode注册的错误信息或者翻译后的错误信息返回错误码的新实例
 func FromMsg(msg string) Codes {
-	m, ok := _errMsg[msg]
-	if !ok {
-		return nil
+	if m, ok := _errMsg[msg]; ok {
+		return m.clone()
+	}
+	if code, ok := translatedCode(msg); ok {
+		return FromCode(code)
 	}
-	return m
+	return nil
 }
 
 func add(errCode uint32, errMsg string) *Code {
@@ -89,8 +220,9 @@ func add(errCode uint32, errMsg string) *Code {
 		panic(fmt.Sprintf("message: %s already exist", errMsg))
 	}
 	code := &Code{
-		ErrCode: errCode,
-		ErrMsg:  errMsg,
+		ErrCode:    errCode,
+		ErrMsg:     errMsg,
+		registered: true,
 	}
 	_codes[errCode] = code
 	_errMsg[errMsg] = code
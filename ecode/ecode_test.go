@@ -0,0 +1,64 @@
+package ecode
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	errOrderNotFound = NewCode(40001, "order not found")
+	errOther         = NewCode(40002, "other")
+)
+
+func TestImmutableCode(t *testing.T) {
+	template := errOrderNotFound
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = template.WithDetail(fmt.Errorf("request %d", i))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, "code: 40001, message: order not found", template.Error())
+	template.AddDetail(errors.New("ignored"))
+	assert.Nil(t, template.Unwrap())
+
+	err := fmt.Errorf("service: %w", template.Wrap(sql.ErrNoRows).WithDetail(errors.New("id=1")))
+	assert.True(t, errors.Is(err, template))
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	var c *Code
+	assert.True(t, errors.As(err, &c))
+	assert.Equal(t, "code: 40001, message: order not found, detail: sql: no rows in result set; id=1", c.Error())
+	assert.False(t, errors.Is(err, errOther))
+
+	fromCode := FromCode(40001)
+	fromCode.AddDetail(errors.New("id=2"))
+	assert.Equal(t, "code: 40001, message: order not found, detail: id=2", fromCode.Error())
+	assert.Nil(t, template.Unwrap())
+	assert.Nil(t, errors.Unwrap(FromCode(40001)))
+
+	wrapped := template.WithDetail(errors.New("id=3")).Wrap(sql.ErrNoRows)
+	assert.Equal(t, "code: 40001, message: order not found, detail: id=3; sql: no rows in result set", wrapped.Error())
+	assert.True(t, errors.Is(wrapped, sql.ErrNoRows))
+
+	msg := template.WithMessagef("order %d not found", 7)
+	assert.Equal(t, "order 7 not found", msg.Message())
+	assert.Equal(t, "bad {{.Name}}", template.WithParams(map[string]any{"Name": "x"}).WithMessagef("bad %s", "{{.Name}}").Message())
+	assert.Equal(t, "order not found", template.Message())
+
+	assert.Empty(t, c.StackTrace())
+	EnableStack(true)
+	defer EnableStack(false)
+	stacked := template.WithDetail(nil)
+	assert.True(t, strings.Contains(fmt.Sprintf("%+v", stacked), "TestImmutableCode"))
+	assert.Equal(t, template.Error(), fmt.Sprintf("%v", stacked))
+}
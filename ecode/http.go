@@ -0,0 +1,35 @@
+package ecode
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/byteflowing/go-common/jsonx"
+)
+
+// HTTPError 返回给http客户端的错误
+type HTTPError struct {
+	Code    uint32 `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewHTTPError 将错误转换为HTTPError，Message按照ctx中的语言翻译（参考WithLanguage），Detail不会返回给客户端
+// 不是Codes的错误Code为0，Message为http状态码的说明，避免内部错误泄露给客户端
+func NewHTTPError(ctx context.Context, err error) *HTTPError {
+	if c, ok := IsCodes(err); ok {
+		return &HTTPError{Code: c.Code(), Message: Message(ctx, c)}
+	}
+	return &HTTPError{Message: http.StatusText(HTTPStatus(err))}
+}
+
+// WriteHTTP 将错误以json写入http响应，状态码参考HTTPStatus，错误信息参考NewHTTPError
+func WriteHTTP(ctx context.Context, w http.ResponseWriter, err error) error {
+	data, marshalErr := jsonx.Marshal(NewHTTPError(ctx, err))
+	if marshalErr != nil {
+		return marshalErr
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(HTTPStatus(err))
+	_, writeErr := w.Write(data)
+	return writeErr
+}
@@ -0,0 +1,290 @@
+package ecode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type languageKey struct{}
+
+var (
+	_i18nMu        sync.RWMutex
+	_translations  = make(map[string]map[uint32]*translation) // language -> code -> message
+	_translatedMsg = make(map[string]map[string]uint32)       // language -> 不含参数的翻译 -> code，用于FromMsg
+	_fallbacks     []string
+	_templates     sync.Map // 未翻译的错误信息 -> *template.Template
+)
+
+type translation struct {
+	msg  string
+	tmpl *template.Template
+}
+
+// RegisterTranslations 注册一种语言的错误信息，相同的错误码会覆盖
+// 错误信息支持text/template，参数通过WithParams传入，例如 "retry after {{.Seconds}}s"
+func RegisterTranslations(lang string, messages map[uint32]string) error {
+	parsed := make(map[uint32]*translation, len(messages))
+	for code, msg := range messages {
+		tmpl, err := template.New(strconv.FormatUint(uint64(code), 10)).Option("missingkey=error").Parse(msg)
+		if err != nil {
+			return fmt.Errorf("ecode: %s %d: %w", lang, code, err)
+		}
+		parsed[code] = &translation{msg: msg, tmpl: tmpl}
+	}
+	lang = normalizeLanguage(lang)
+	_i18nMu.Lock()
+	defer _i18nMu.Unlock()
+	if _translations[lang] == nil {
+		_translations[lang] = make(map[uint32]*translation, len(parsed))
+	}
+	for code, t := range parsed {
+		_translations[lang][code] = t
+	}
+	_translatedMsg[lang] = indexTranslations(_translations[lang])
+	return nil
+}
+
+// indexTranslations 建立翻译到错误码的索引，只包含不含参数的翻译，多个错误码的翻译相同时无法区分，不加入索引
+func indexTranslations(translations map[uint32]*translation) map[string]uint32 {
+	index := make(map[string]uint32, len(translations))
+	duplicated := make(map[string]bool)
+	for code, t := range translations {
+		if strings.Contains(t.msg, "{{") {
+			continue
+		}
+		if existing, ok := index[t.msg]; ok && existing != code {
+			duplicated[t.msg] = true
+		}
+		index[t.msg] = code
+	}
+	for msg := range duplicated {
+		delete(index, msg)
+	}
+	return index
+}
+
+// LoadTranslations 从yaml读取一种语言的错误信息，格式为 错误码: 错误信息
+func LoadTranslations(lang string, data []byte) error {
+	var messages map[uint32]string
+	if err := yaml.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("ecode: %s: %w", lang, err)
+	}
+	return RegisterTranslations(lang, messages)
+}
+
+// LoadTranslationsFS 读取fsys中匹配pattern的yaml文件，文件名（不含扩展名）为语言，例如 i18n/zh-CN.yaml
+// 可以配合embed使用：
+//
+//	//go:embed i18n/*.yaml
+//	var i18nFS embed.FS
+//	ecode.LoadTranslationsFS(i18nFS, "i18n/*.yaml")
+func LoadTranslationsFS(fsys fs.FS, pattern string) error {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		base := path.Base(file)
+		if err := LoadTranslations(strings.TrimSuffix(base, path.Ext(base)), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetFallbackLanguages 设置请求的语言都没有翻译时依次尝试的语言，都没有时使用NewCode注册的错误信息
+func SetFallbackLanguages(langs ...string) {
+	normalized := make([]string, len(langs))
+	for i, lang := range langs {
+		normalized[i] = normalizeLanguage(lang)
+	}
+	_i18nMu.Lock()
+	defer _i18nMu.Unlock()
+	_fallbacks = normalized
+}
+
+// WithLanguage 在ctx中设置优先使用的语言，可以设置多个，按顺序尝试
+func WithLanguage(ctx context.Context, langs ...string) context.Context {
+	return context.WithValue(ctx, languageKey{}, langs)
+}
+
+// LanguageFromCtx 返回ctx中的语言
+func LanguageFromCtx(ctx context.Context) []string {
+	langs, _ := ctx.Value(languageKey{}).([]string)
+	return langs
+}
+
+// ParseAcceptLanguage 解析http请求头Accept-Language，按照权重从高到低返回，例如 "zh-CN,zh;q=0.9,en;q=0.8"
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var items []weighted
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			items = append(items, weighted{lang: lang, q: q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].q > items[j].q })
+	langs := make([]string, len(items))
+	for i, item := range items {
+		langs[i] = item.lang
+	}
+	return langs
+}
+
+// Message 返回err按照ctx中的语言翻译的错误信息，err不是Codes时返回err.Error()
+func Message(ctx context.Context, err error) string {
+	c, ok := IsCodes(err)
+	if !ok {
+		if err == nil {
+			return ""
+		}
+		return err.Error()
+	}
+	var code *Code
+	if !errors.As(err, &code) {
+		return c.Message()
+	}
+	return code.MessageFor(LanguageFromCtx(ctx)...)
+}
+
+// WithParams 返回带有模板参数的新实例，params为map或者struct，模板中通过 {{.Name}} 引用
+// 限流的RetryAfter可以直接传入，time.Duration和*int64(秒)都会转换为 {"Seconds": 秒数}：
+//
+//	ErrTooManyRequests.WithParams(result.RetryAfter) // "retry after {{.Seconds}}s" -> "retry after 30s"
+//	ErrTooManyRequests.WithParams(rule.RetryAfter)
+func (c *Code) WithParams(params any) *Code {
+	n := c.clone()
+	n.params = normalizeParams(params)
+	return n
+}
+
+func normalizeParams(params any) any {
+	switch v := params.(type) {
+	case time.Duration:
+		return map[string]any{"Seconds": int64((v + time.Second - 1) / time.Second)}
+	case *int64:
+		if v == nil {
+			return nil
+		}
+		return map[string]any{"Seconds": *v}
+	case int64, int:
+		return map[string]any{"Seconds": v}
+	}
+	return params
+}
+
+// MessageFor 返回指定语言的错误信息
+// 每种语言依次尝试去掉后缀，例如 zh-Hant-TW、zh-Hant、zh，然后尝试SetFallbackLanguages设置的语言
+// 都没有翻译、参数不足以渲染翻译或者通过WithMessagef设置了错误信息时，返回Message()
+// 参数不足以渲染错误信息时使用WithFallbackMessage设置的信息，参考Message
+func (c *Code) MessageFor(langs ...string) string {
+	if !c.custom {
+		if t, ok := lookupTranslation(c.ErrCode, langs); ok {
+			var buf bytes.Buffer
+			if err := t.tmpl.Execute(&buf, c.params); err == nil {
+				return buf.String()
+			}
+		}
+	}
+	return c.Message()
+}
+
+// translatedCode 返回不含参数的翻译对应的错误码，不同语言中相同的翻译对应不同的错误码时返回false
+func translatedCode(msg string) (uint32, bool) {
+	_i18nMu.RLock()
+	defer _i18nMu.RUnlock()
+	var found uint32
+	ok := false
+	for _, index := range _translatedMsg {
+		code, exists := index[msg]
+		if !exists {
+			continue
+		}
+		if ok && code != found {
+			return 0, false
+		}
+		found, ok = code, true
+	}
+	return found, ok
+}
+
+func lookupTranslation(code uint32, langs []string) (*translation, bool) {
+	_i18nMu.RLock()
+	defer _i18nMu.RUnlock()
+	if len(_translations) == 0 {
+		return nil, false
+	}
+	for _, chain := range [][]string{langs, _fallbacks} {
+		for _, lang := range chain {
+			for lang = normalizeLanguage(lang); lang != ""; lang = parentLanguage(lang) {
+				if t, ok := _translations[lang][code]; ok {
+					return t, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// renderMessage 使用参数渲染未翻译的错误信息，缺少参数或者渲染失败时返回false，不会把模板原文返回给客户端
+func renderMessage(msg string, params any) (string, bool) {
+	if !strings.Contains(msg, "{{") {
+		return msg, true
+	}
+	if params == nil {
+		return "", false
+	}
+	cached, ok := _templates.Load(msg)
+	if !ok {
+		tmpl, err := template.New("").Option("missingkey=error").Parse(msg)
+		if err != nil {
+			return "", false
+		}
+		cached, _ = _templates.LoadOrStore(msg, tmpl)
+	}
+	var buf bytes.Buffer
+	if err := cached.(*template.Template).Execute(&buf, params); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+func normalizeLanguage(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
+
+func parentLanguage(lang string) string {
+	if i := strings.LastIndexByte(lang, '-'); i > 0 {
+		return lang[:i]
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package ecode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	errRetryAfter = NewCode(42902, "retry after {{.Seconds}}s", WithFallbackMessage("too many requests"))
+	errNotFound   = NewCode(40402, "not found")
+	errWait       = NewCode(42903, "wait {{.Seconds}}s", WithHTTPStatus(http.StatusTooManyRequests))
+)
+
+func TestI18n(t *testing.T) {
+	limited, notFound := errRetryAfter, errNotFound
+	fsys := fstest.MapFS{
+		"i18n/zh-CN.yaml": {Data: []byte("42902: \"请{{.Seconds}}秒后重试\"\n40402: 未找到\n")},
+		"i18n/zh.yaml":    {Data: []byte("40402: 不存在\n")},
+		"i18n/en.yaml":    {Data: []byte("40402: Not Found\n")},
+	}
+	assert.NoError(t, LoadTranslationsFS(fsys, "i18n/*.yaml"))
+	SetFallbackLanguages("en")
+	defer SetFallbackLanguages()
+
+	err := limited.WithParams(30 * time.Second)
+	assert.Equal(t, "retry after 30s", err.Message())
+	assert.Equal(t, "请30秒后重试", err.MessageFor("zh_CN"))
+	assert.Equal(t, "请5秒后重试", limited.WithParams(map[string]any{"Seconds": int64(5)}).MessageFor("zh-CN"))
+
+	assert.Equal(t, "未找到", notFound.MessageFor("zh-CN"))
+	assert.Equal(t, "不存在", notFound.MessageFor("zh-Hant-TW"))
+	assert.Equal(t, "Not Found", notFound.MessageFor("fr"))
+	assert.Equal(t, "custom", notFound.WithMessagef("custom").MessageFor("zh"))
+
+	langs := ParseAcceptLanguage("fr;q=0.5, zh-TW,en;q=0.8")
+	assert.Equal(t, []string{"zh-TW", "en", "fr"}, langs)
+	ctx := WithLanguage(context.Background(), langs...)
+	assert.Equal(t, "不存在", Message(ctx, notFound.WithDetail(nil)))
+
+	assert.Error(t, RegisterTranslations("en", map[uint32]string{42902: "{{.Seconds"}))
+
+	// RetryAfter为*int64(秒)时同样可以渲染，没有参数时不会返回模板原文
+	seconds := int64(7)
+	assert.Equal(t, "请7秒后重试", limited.WithParams(&seconds).MessageFor("zh-CN"))
+	assert.Equal(t, "too many requests", limited.Message())
+	assert.Equal(t, "too many requests", limited.WithParams(map[string]any{}).MessageFor("zh-CN"))
+	assert.Equal(t, "Too Many Requests", errWait.Message())
+
+	// 只能通过不含参数的翻译查找错误码，相同的翻译对应多个错误码时无法查找
+	assert.Equal(t, uint32(40402), FromMsg("未找到").Code())
+	assert.Nil(t, FromMsg("请30秒后重试"))
+	assert.Nil(t, FromMsg("请{{.Seconds}}秒后重试"))
+	assert.NoError(t, RegisterTranslations("zh-CN", map[uint32]string{40402: "找不到"}))
+	assert.Nil(t, FromMsg("未找到"))
+	assert.Equal(t, uint32(40402), FromMsg("找不到").Code())
+	assert.NoError(t, RegisterTranslations("ja", map[uint32]string{40402: "same", 42903: "same"}))
+	assert.Nil(t, FromMsg("same"))
+	assert.NoError(t, RegisterTranslations("zh-CN", map[uint32]string{40402: "未找到"}))
+
+	ctx = WithLanguage(context.Background(), "zh-CN")
+	w := httptest.NewRecorder()
+	assert.NoError(t, WriteHTTP(ctx, w, limited.WithParams(30*time.Second)))
+	assert.JSONEq(t, `{"code":42902,"message":"请30秒后重试"}`, w.Body.String())
+	assert.Equal(t, "请30秒后重试", ToGRPCStatus(ctx, limited.WithParams(30*time.Second)).Message())
+}
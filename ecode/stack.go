@@ -0,0 +1,58 @@
+package ecode
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+const maxStackDepth = 32
+
+var captureStack atomic.Bool
+
+// EnableStack 开启后WithDetail、Wrap、WithMessagef创建实例时记录调用栈，默认关闭
+// 通过 fmt.Sprintf("%+v", err) 或者StackTrace输出
+func EnableStack(enabled bool) {
+	captureStack.Store(enabled)
+}
+
+// StackTrace 返回创建实例时的调用栈，没有记录时返回空字符串
+func (c *Code) StackTrace() string {
+	if len(c.stack) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	frames := runtime.CallersFrames(c.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// Format %+v时输出调用栈
+func (c *Code) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		_, _ = io.WriteString(s, c.Error())
+		if s.Flag('+') && len(c.stack) > 0 {
+			_, _ = io.WriteString(s, "\n"+c.StackTrace())
+		}
+	case 's':
+		_, _ = io.WriteString(s, c.Error())
+	case 'q':
+		_, _ = fmt.Fprintf(s, "%q", c.Error())
+	}
+}
+
+// callers 跳过runtime.Callers、callers、clone以及WithDetail等方法
+func callers() []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(4, pcs)
+	return pcs[:n]
+}
@@ -0,0 +1,171 @@
+package ecode
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ErrorDomain grpc status中ErrorInfo的Domain，用于识别ecode的错误码
+	ErrorDomain = "ecode"
+	// unknownMessage 不是Codes的错误返回给grpc客户端的信息，避免内部错误泄露给客户端
+	unknownMessage = "unknown error"
+)
+
+// HTTPStatus 返回错误对应的http状态码，err为nil时返回200，不是Codes时返回500
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	opts := statusOpts(err)
+	switch {
+	case opts == nil:
+		return http.StatusInternalServerError
+	case opts.HTTPStatus != 0:
+		return opts.HTTPStatus
+	case opts.GRPCCode != codes.OK:
+		return httpStatusFromGRPC(opts.GRPCCode)
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode 返回错误对应的grpc状态码，err为nil时返回codes.OK，不是Codes时返回codes.Unknown
+func GRPCCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	opts := statusOpts(err)
+	switch {
+	case opts == nil:
+		return codes.Unknown
+	case opts.GRPCCode != codes.OK:
+		return opts.GRPCCode
+	case opts.HTTPStatus != 0:
+		return grpcCodeFromHTTP(opts.HTTPStatus)
+	}
+	return codes.Unknown
+}
+
+// ToGRPCStatus 将错误转换为grpc status，错误码通过ErrorInfo放在status.Details中，Detail不会返回给客户端
+// 错误信息按照ctx中的语言翻译，参考WithLanguage
+// err为nil时返回codes.OK，不是Codes的错误返回codes.Unknown和通用的错误信息
+func ToGRPCStatus(ctx context.Context, err error) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	c, ok := IsCodes(err)
+	if !ok {
+		return status.New(codes.Unknown, unknownMessage)
+	}
+	s := status.New(GRPCCode(err), Message(ctx, c))
+	withDetails, detailErr := s.WithDetails(&errdetails.ErrorInfo{
+		Reason: strconv.FormatUint(uint64(c.Code()), 10),
+		Domain: ErrorDomain,
+	})
+	if detailErr != nil {
+		return s
+	}
+	return withDetails
+}
+
+// FromGRPCStatus 从ToGRPCStatus返回的status中还原错误码和错误信息，status中没有错误码时返回nil
+// 错误码在本地注册过时与FromCode一样返回副本，带有注册时设置的http/grpc状态码
+func FromGRPCStatus(s *status.Status) Codes {
+	for _, detail := range s.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != ErrorDomain {
+			continue
+		}
+		code, err := strconv.ParseUint(info.Reason, 10, 32)
+		if err != nil {
+			continue
+		}
+		// 服务端已经渲染过错误信息，不再作为模板渲染
+		c, ok := _codes[uint32(code)]
+		if !ok {
+			return &Code{ErrCode: uint32(code), ErrMsg: s.Message(), custom: true}
+		}
+		restored := c.clone()
+		restored.ErrMsg, restored.custom = s.Message(), true
+		return restored
+	}
+	return nil
+}
+
+func statusOpts(err error) *CodeOpts {
+	c, ok := IsCodes(err)
+	if !ok {
+		return nil
+	}
+	registered, ok := _codes[c.Code()]
+	if !ok || registered.status == nil {
+		return &CodeOpts{}
+	}
+	return registered.status
+}
+
+func httpStatusFromGRPC(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func grpcCodeFromHTTP(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	switch {
+	case status >= 200 && status < 300:
+		// 错误码不应该对应成功的状态码，不能让客户端认为请求成功
+		return codes.Unknown
+	case status >= 400 && status < 500:
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
@@ -0,0 +1,60 @@
+package ecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errUserNotFound = NewCode(40401, "user not found", WithHTTPStatus(http.StatusNotFound))
+	errLimited      = NewCode(42901, "too many requests", WithGRPCCode(codes.ResourceExhausted))
+	errPlain        = NewCode(50001, "plain error")
+	errAccepted     = NewCode(20001, "accepted", WithHTTPStatus(http.StatusAccepted))
+)
+
+func TestStatus(t *testing.T) {
+	notFound, limited, plain := errUserNotFound, errLimited, errPlain
+
+	assert.Equal(t, http.StatusNotFound, HTTPStatus(notFound))
+	assert.Equal(t, codes.NotFound, GRPCCode(notFound))
+	assert.Equal(t, http.StatusTooManyRequests, HTTPStatus(fmt.Errorf("wrap: %w", limited)))
+	assert.Equal(t, codes.ResourceExhausted, GRPCCode(limited))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(plain))
+	assert.Equal(t, codes.Unknown, GRPCCode(errors.New("io")))
+
+	s := ToGRPCStatus(context.Background(), limited)
+	assert.Equal(t, codes.ResourceExhausted, s.Code())
+	restored := FromGRPCStatus(status.Convert(s.Err()))
+	assert.Equal(t, uint32(42901), restored.Code())
+	assert.Equal(t, "too many requests", restored.Message())
+	assert.Equal(t, http.StatusTooManyRequests, HTTPStatus(restored))
+	restored.AddDetail(errors.New("remote"))
+	assert.Equal(t, "code: 42901, message: too many requests, detail: remote", restored.Error())
+	assert.Nil(t, errors.Unwrap(limited))
+	// 服务端返回的信息不作为模板渲染
+	remote, err := status.New(codes.Internal, "bad {{.Name}}").WithDetails(&errdetails.ErrorInfo{Reason: "50099", Domain: ErrorDomain})
+	assert.NoError(t, err)
+	assert.Equal(t, "bad {{.Name}}", FromGRPCStatus(remote).Message())
+	assert.Nil(t, FromGRPCStatus(status.New(codes.Internal, "x")))
+
+	s = ToGRPCStatus(context.Background(), errors.New("dial tcp 10.0.0.1:3306: connection refused"))
+	assert.Equal(t, codes.Unknown, s.Code())
+	assert.Equal(t, "unknown error", s.Message())
+	assert.Equal(t, codes.OK, ToGRPCStatus(context.Background(), nil).Code())
+	assert.Equal(t, codes.Unknown, GRPCCode(errAccepted))
+	assert.Equal(t, "", (&Code{ErrCode: 99999}).Message())
+
+	w := httptest.NewRecorder()
+	assert.NoError(t, WriteHTTP(context.Background(), w, &Code{ErrCode: 40401, ErrMsg: "user not found", Detail: errors.New("sql: no rows")}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"code":40401,"message":"user not found"}`, w.Body.String())
+}
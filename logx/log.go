@@ -138,6 +138,12 @@ func CtxFatal(ctx context.Context, msg string, fields ...zap.Field) {
 	std.Fatal(msg, fs...)
 }
 
+// CtxFields 如果ctx中有log id，在fields前加上log id字段
+// 用于使用自定义zap.Logger时保持与CtxInfo等方法一致的log id
+func CtxFields(ctx context.Context, fields ...zap.Field) []zap.Field {
+	return addLogIdToFields(ctx, fields)
+}
+
 func addLogIdToFields(ctx context.Context, fields []zap.Field) []zap.Field {
 	logId := GetCtxLogID(ctx)
 	logIdKey := stdConfig.LogIdKey
@@ -0,0 +1,110 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	auditPluginName        = "orm:audit"
+	defaultCreatedByColumn = "created_by"
+	defaultUpdatedByColumn = "updated_by"
+)
+
+type operatorCtxKey struct{}
+
+// WithOperator 在ctx中设置当前操作人，AuditPlugin会用它填充created_by/updated_by
+func WithOperator(ctx context.Context, operator any) context.Context {
+	return context.WithValue(ctx, operatorCtxKey{}, operator)
+}
+
+// OperatorFromCtx 返回ctx中的操作人
+func OperatorFromCtx(ctx context.Context) (operator any, ok bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	operator = ctx.Value(operatorCtxKey{})
+	return operator, operator != nil
+}
+
+// AuditPlugin 创建时自动填充created_by和updated_by，更新时自动填充updated_by
+// 只对包含对应列的model生效，ctx中没有操作人时不做处理
+// 用法：db.Use(orm.NewAuditPlugin())，db.WithContext(orm.WithOperator(ctx, uid)).Create(&user)
+type AuditPlugin struct {
+	CreatedByColumn string
+	UpdatedByColumn string
+}
+
+func NewAuditPlugin() *AuditPlugin {
+	return &AuditPlugin{
+		CreatedByColumn: defaultCreatedByColumn,
+		UpdatedByColumn: defaultUpdatedByColumn,
+	}
+}
+
+func (p *AuditPlugin) Name() string {
+	return auditPluginName
+}
+
+func (p *AuditPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register(auditPluginName, p.beforeCreate); err != nil {
+		return err
+	}
+	return cb.Update().Before("gorm:update").Register(auditPluginName, p.beforeUpdate)
+}
+
+func (p *AuditPlugin) beforeCreate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	operator, ok := OperatorFromCtx(db.Statement.Context)
+	if !ok {
+		return
+	}
+	for _, column := range []string{p.CreatedByColumn, p.UpdatedByColumn} {
+		if field := db.Statement.Schema.LookUpField(column); field != nil {
+			setFieldIfZero(db, field, operator)
+		}
+	}
+}
+
+func (p *AuditPlugin) beforeUpdate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	operator, ok := OperatorFromCtx(db.Statement.Context)
+	if !ok {
+		return
+	}
+	if field := db.Statement.Schema.LookUpField(p.UpdatedByColumn); field != nil {
+		db.Statement.SetColumn(field.DBName, operator, true)
+	}
+}
+
+// setFieldIfZero 为单条或批量创建的每一行设置字段值，已经设置过的不覆盖
+func setFieldIfZero(db *gorm.DB, field *schema.Field, value any) {
+	ctx := db.Statement.Context
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			row := reflect.Indirect(rv.Index(i))
+			if _, zero := field.ValueOf(ctx, row); zero {
+				if err := field.Set(ctx, row, value); err != nil {
+					_ = db.AddError(err)
+					return
+				}
+			}
+		}
+	case reflect.Struct:
+		if _, zero := field.ValueOf(ctx, rv); zero {
+			if err := field.Set(ctx, rv, value); err != nil {
+				_ = db.AddError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package orm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+
+	"github.com/byteflowing/go-common/cache"
+	"github.com/byteflowing/go-common/jsonx"
+	"github.com/byteflowing/go-common/redis"
+)
+
+const (
+	queryCachePluginName = "orm:query_cache"
+	queryCacheKey        = "orm:query_cache"
+	defaultCachePrefix   = "orm:cache:"
+	defaultCacheMaxTTL   = 10 * time.Minute
+)
+
+// ErrCacheMiss CacheStore中没有对应的key
+var ErrCacheMiss = errors.New("orm: cache miss")
+
+// CacheStore 查询缓存的存储
+type CacheStore interface {
+	// Get key不存在时返回ErrCacheMiss
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set ttl<=0表示不过期
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type localCacheStore struct {
+	c *cache.Cache
+}
+
+// NewLocalCacheStore 使用进程内缓存，只适用于单实例或者允许各实例短暂不一致的场景
+func NewLocalCacheStore(c *cache.Cache) CacheStore {
+	return &localCacheStore{c: c}
+}
+
+func (s *localCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.c.Get(key)
+	if errors.Is(err, cache.ErrNotFound) {
+		return nil, ErrCacheMiss
+	}
+	return value, err
+}
+
+func (s *localCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	expireSeconds := 0
+	if ttl > 0 {
+		expireSeconds = max(int(ttl/time.Second), 1)
+	}
+	return s.c.Set(key, value, expireSeconds)
+}
+
+type redisCacheStore struct {
+	r *redis.Redis
+}
+
+// NewRedisCacheStore 使用redis缓存，多个实例共享缓存和失效标记
+func NewRedisCacheStore(r *redis.Redis) CacheStore {
+	return &redisCacheStore{r: r}
+}
+
+func (s *redisCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.r.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCacheMiss
+	}
+	return value, err
+}
+
+func (s *redisCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.r.Set(ctx, key, value, max(ttl, 0)).Err()
+}
+
+type cacheSetting struct {
+	ttl    time.Duration
+	tables []string
+}
+
+type cacheEntry struct {
+	Rows int64  `json:"r"`
+	Dest []byte `json:"d"`
+}
+
+// Cached 缓存查询结果的scope，用法：db.Scopes(orm.Cached(time.Minute)).Find(&users)
+// 缓存按照表打标签，表发生写入时自动失效；查询join了其他表时需要通过tables指定，否则其他表的写入不会使缓存失效
+// ttl<=0或者超过QueryCachePlugin.MaxTTL时使用MaxTTL
+// 事务中的查询不使用缓存；查询的目标需要能够被json序列化
+func Cached(ttl time.Duration, tables ...string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(queryCacheKey, &cacheSetting{ttl: ttl, tables: tables})
+	}
+}
+
+// QueryCachePlugin 查询缓存
+// 缓存key为带参数的完整SQL和相关表标签的哈希，每个表有一个标签值，
+// 通过gorm写入（Create/Update/Delete）时更新标签值，旧的缓存不再命中并等待过期
+// 原生SQL(Exec)的写入不会自动失效，需要调用InvalidateTables
+// WithTx中的写入在提交后会再失效一次；db.Transaction、Begin/Commit中的写入只在执行语句时失效，
+// 提交前其他请求读到的旧数据会被缓存到过期，需要在提交后调用InvalidateTables
+// 标签不存在（未写入过或者被淘汰）时写入新的标签值，不会命中标签丢失前的缓存
+// 用法：db.Use(orm.NewQueryCachePlugin(orm.NewRedisCacheStore(rdb)))
+type QueryCachePlugin struct {
+	Store  CacheStore
+	Prefix string
+	// MaxTTL 查询缓存的最长过期时间，默认10分钟，限制标签失效后旧缓存的存留时间
+	MaxTTL time.Duration
+}
+
+func NewQueryCachePlugin(store CacheStore) *QueryCachePlugin {
+	return &QueryCachePlugin{Store: store, Prefix: defaultCachePrefix, MaxTTL: defaultCacheMaxTTL}
+}
+
+func (p *QueryCachePlugin) Name() string {
+	return queryCachePluginName
+}
+
+func (p *QueryCachePlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Replace("gorm:query", p.query); err != nil {
+		return err
+	}
+	invalidate := p.invalidator(db)
+	if err := cb.Create().After("gorm:create").Register(queryCachePluginName, invalidate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register(queryCachePluginName, invalidate); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register(queryCachePluginName, invalidate)
+}
+
+// InvalidateTables 使表相关的缓存失效
+func (p *QueryCachePlugin) InvalidateTables(ctx context.Context, tables ...string) error {
+	value := newCacheTag()
+	var errs []error
+	for _, table := range tables {
+		errs = append(errs, p.Store.Set(ctx, p.tagKey(table), value, 0))
+	}
+	return errors.Join(errs...)
+}
+
+func newCacheTag() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+}
+
+func (p *QueryCachePlugin) ttl(ttl time.Duration) time.Duration {
+	maxTTL := p.MaxTTL
+	if maxTTL <= 0 {
+		maxTTL = defaultCacheMaxTTL
+	}
+	if ttl <= 0 || ttl > maxTTL {
+		return maxTTL
+	}
+	return ttl
+}
+
+func (p *QueryCachePlugin) tagKey(table string) string {
+	return p.Prefix + "tag:" + table
+}
+
+func (p *QueryCachePlugin) query(db *gorm.DB) {
+	setting, ok := cachedSetting(db)
+	if !ok || db.Error != nil {
+		callbacks.Query(db)
+		return
+	}
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil || db.DryRun {
+		callbacks.Query(db)
+		return
+	}
+	ctx := db.Statement.Context
+	key, err := p.cacheKey(db, setting)
+	if err != nil {
+		// 缓存不可用时直接查询数据库
+		callbacks.Query(db)
+		return
+	}
+	if data, err := p.Store.Get(ctx, key); err == nil {
+		var entry cacheEntry
+		if err := jsonx.Unmarshal(data, &entry); err == nil && jsonx.Unmarshal(entry.Dest, db.Statement.Dest) == nil {
+			db.RowsAffected = entry.Rows
+			if entry.Rows == 0 && db.Statement.RaiseErrorOnNotFound {
+				_ = db.AddError(gorm.ErrRecordNotFound)
+			}
+			return
+		}
+	}
+	callbacks.Query(db)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		return
+	}
+	dest, err := jsonx.Marshal(db.Statement.Dest)
+	if err != nil {
+		return
+	}
+	if data, err := jsonx.Marshal(&cacheEntry{Rows: db.RowsAffected, Dest: dest}); err == nil {
+		_ = p.Store.Set(ctx, key, data, p.ttl(setting.ttl))
+	}
+}
+
+// cachedSetting 只有标记了Cached并且不在事务中的查询使用缓存
+func cachedSetting(db *gorm.DB) (*cacheSetting, bool) {
+	v, ok := db.Get(queryCacheKey)
+	if !ok {
+		return nil, false
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return nil, false
+	}
+	setting, ok := v.(*cacheSetting)
+	return setting, ok
+}
+
+func (p *QueryCachePlugin) cacheKey(db *gorm.DB, setting *cacheSetting) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...)))
+	tables := append([]string{db.Statement.Table}, setting.tables...)
+	for _, table := range tables {
+		tag, err := p.tag(db.Statement.Context, table)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+		h.Write([]byte(table))
+		h.Write([]byte{0})
+		h.Write(tag)
+	}
+	return p.Prefix + "q:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tag 返回表的标签值，不存在时写入新的标签值
+// 标签丢失后不能按照空标签计算key，否则会命中标签丢失前写入的旧缓存
+func (p *QueryCachePlugin) tag(ctx context.Context, table string) ([]byte, error) {
+	tag, err := p.Store.Get(ctx, p.tagKey(table))
+	if err == nil {
+		return tag, nil
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		return nil, err
+	}
+	tag = newCacheTag()
+	if err := p.Store.Set(ctx, p.tagKey(table), tag, 0); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// invalidator 返回写入后使缓存失效的callback
+// WithTx以根db的Config区分事务，callback中的db是Session复制了Config的实例，需要使用根db判断是否在事务中
+func (p *QueryCachePlugin) invalidator(root *gorm.DB) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.Table == "" || db.DryRun {
+			return
+		}
+		ctx := db.Statement.Context
+		table := db.Statement.Table
+		_ = p.InvalidateTables(ctx, table)
+		if !InTx(ctx, root) {
+			return
+		}
+		// 事务提交前其他请求可能读取到旧数据并写入缓存，提交后再失效一次
+		// gorm的Commit没有callback，只有WithTx开启的事务可以在提交后失效
+		AfterCommit(ctx, root, func(ctx context.Context) {
+			_ = p.InvalidateTables(ctx, table)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package orm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/byteflowing/go-common/cache"
+)
+
+func TestQueryCachePlugin(t *testing.T) {
+	db := New(newSQLiteConfig(t, "cache.db"))
+	assert.NoError(t, db.Use(NewQueryCachePlugin(NewLocalCacheStore(cache.New(&cache.Opts{Size: 1024 * 1024})))))
+	assert.NoError(t, db.AutoMigrate(&testUser{}))
+	ctx := context.Background()
+	assert.NoError(t, db.Create(&testUser{Name: "a"}).Error)
+
+	var users []testUser
+	assert.NoError(t, db.Scopes(Cached(time.Minute)).Find(&users).Error)
+	assert.Len(t, users, 1)
+
+	// 绕过gorm写入，缓存不会失效
+	assert.NoError(t, db.Exec("INSERT INTO test_users (name) VALUES (?)", "b").Error)
+	users = nil
+	assert.NoError(t, db.Scopes(Cached(time.Minute)).Find(&users).Error)
+	assert.Len(t, users, 1)
+
+	// 通过gorm写入使缓存失效
+	assert.NoError(t, db.Create(&testUser{Name: "c"}).Error)
+	users = nil
+	assert.NoError(t, db.Scopes(Cached(time.Minute)).Find(&users).Error)
+	assert.Len(t, users, 3)
+
+	var user testUser
+	assert.ErrorIs(t, db.Scopes(Cached(time.Minute)).Where("name = ?", "d").First(&user).Error, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, db.Scopes(Cached(time.Minute)).Where("name = ?", "d").First(&user).Error, gorm.ErrRecordNotFound)
+
+	var count int64
+	assert.NoError(t, db.Model(&testUser{}).Scopes(Cached(time.Minute)).Count(&count).Error)
+	assert.Equal(t, int64(3), count)
+	assert.NoError(t, WithTx(ctx, db, func(ctx context.Context) error {
+		return FromCtx(ctx, db).Where("name = ?", "a").Delete(&testUser{}).Error
+	}))
+	assert.NoError(t, db.Model(&testUser{}).Scopes(Cached(time.Minute)).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
+
+type mapCacheStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+}
+
+func newMapCacheStore() *mapCacheStore {
+	return &mapCacheStore{data: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (s *mapCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.data[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return value, nil
+}
+
+func (s *mapCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+func TestQueryCachePlugin_TagEvicted(t *testing.T) {
+	db := New(newSQLiteConfig(t, "cache_tag.db"))
+	store := newMapCacheStore()
+	plugin := NewQueryCachePlugin(store)
+	assert.NoError(t, db.Use(plugin))
+	assert.NoError(t, db.AutoMigrate(&testUser{}))
+	assert.NoError(t, db.Exec("INSERT INTO test_users (name) VALUES (?)", "a").Error)
+
+	var users []testUser
+	assert.NoError(t, db.Scopes(Cached(0)).Find(&users).Error)
+	assert.Len(t, users, 1)
+	for key, ttl := range store.ttls {
+		if !strings.HasPrefix(key, plugin.tagKey("")) {
+			assert.Equal(t, defaultCacheMaxTTL, ttl)
+		}
+	}
+
+	// 标签被淘汰后写入新的标签，不会命中标签丢失前的缓存
+	assert.NoError(t, db.Create(&testUser{Name: "b"}).Error)
+	store.mu.Lock()
+	delete(store.data, plugin.tagKey("test_users"))
+	store.mu.Unlock()
+	users = nil
+	assert.NoError(t, db.Scopes(Cached(0)).Find(&users).Error)
+	assert.Len(t, users, 2)
+}
+
+func TestQueryCachePlugin_PlainTransaction(t *testing.T) {
+	db := New(newSQLiteConfig(t, "cache_tx.db"))
+	plugin := NewQueryCachePlugin(newMapCacheStore())
+	assert.NoError(t, db.Use(plugin))
+	assert.NoError(t, db.AutoMigrate(&testUser{}))
+	ctx := context.Background()
+	count := func() int64 {
+		var n int64
+		assert.NoError(t, db.Model(&testUser{}).Scopes(Cached(time.Minute)).Count(&n).Error)
+		return n
+	}
+
+	// db.Transaction提交前读到的旧数据会一直被缓存，需要提交后手动失效
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&testUser{Name: "a"}).Error; err != nil {
+			return err
+		}
+		assert.Equal(t, int64(0), count())
+		return nil
+	}))
+	assert.Equal(t, int64(0), count())
+	assert.NoError(t, plugin.InvalidateTables(ctx, "test_users"))
+	assert.Equal(t, int64(1), count())
+
+	// WithTx提交后自动失效
+	assert.NoError(t, WithTx(ctx, db, func(ctx context.Context) error {
+		if err := FromCtx(ctx, db).Create(&testUser{Name: "b"}).Error; err != nil {
+			return err
+		}
+		assert.Equal(t, int64(1), count())
+		return nil
+	}))
+	assert.Equal(t, int64(2), count())
+}
@@ -1,9 +1,7 @@
 package orm
 
 import (
-	"fmt"
 	"io"
-	"net/url"
 	"os"
 	"time"
 
@@ -64,59 +62,3 @@ func getMaxOpenConnes(config *configv1.DbConn) int {
 func getConnMaxLifetime(config *configv1.DbConn) time.Duration {
 	return time.Duration(config.ConnMaxLifeTime) * time.Second
 }
-
-func getMySqlDSN(config *configv1.DbMysql) string {
-	escapedLoc := url.QueryEscape(config.Location)
-	const format = "%s:%s@tcp(%s:%d)/%s?parseTime=True&charset=%s&loc=%s&timeout=%v&readTimeout=%v&writeTimeout=%v"
-	return fmt.Sprintf(
-		format,
-		config.User,
-		config.Password,
-		config.Host,
-		config.Port,
-		config.DbName,
-		config.Charset,
-		escapedLoc,
-		time.Duration(config.ConnTimeout)*time.Second,
-		time.Duration(config.ReadTimeout)*time.Second,
-		time.Duration(config.WriteTimeout)*time.Second,
-	)
-}
-
-func getPostgresSSLMode(config *configv1.DbPostgres) string {
-	if config.SslMode {
-		return "enable"
-	}
-	return "disable"
-}
-
-func getPostgresDSN(config *configv1.DbPostgres) string {
-	const format = "host=%s, user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s search_path=%s"
-	return fmt.Sprintf(
-		format,
-		config.Host,
-		config.User,
-		config.Password,
-		config.DbName,
-		config.Port,
-		getPostgresSSLMode(config),
-		config.TimeZone,
-		config.Schema,
-	)
-}
-
-func getSQLServerDSN(config *configv1.DbSQLServer) string {
-	const format = "sqlserver://%s:%s@%s:%d?database=%s"
-	return fmt.Sprintf(
-		format,
-		config.User,
-		config.Password,
-		config.Host,
-		config.Port,
-		config.DbName,
-	)
-}
-
-func getSqliteDSN(config *configv1.DbSQLite) string {
-	return config.DbPath
-}
@@ -0,0 +1,279 @@
+package orm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/byteflowing/go-common/idx"
+	"github.com/byteflowing/go-common/jsonx"
+)
+
+var (
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrNoCursorColumn   = errors.New("no cursor column")
+	ErrUnknownCursorCol = errors.New("unknown cursor column")
+)
+
+// CursorColumn 游标分页的排序列
+type CursorColumn struct {
+	Column string // 数据库列名或者结构体字段名
+	Desc   bool   // 是否倒序
+}
+
+// Cursor 游标内容，记录翻页方向和边界行的排序列的值
+type Cursor struct {
+	Prev   bool              `json:"p,omitempty"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// CursorEncoder 游标编解码，默认使用base64(json)
+type CursorEncoder interface {
+	Encode(cursor *Cursor) (string, error)
+	Decode(s string) (*Cursor, error)
+}
+
+type CursorOpts struct {
+	Columns []CursorColumn // 排序列，如果不包含主键会自动追加主键作为tie-breaker，保证排序稳定
+	Limit   uint32         // 每页数量，默认10
+	Cursor  string         // 上一次返回的NextCursor或者PrevCursor，为空表示第一页
+	Encoder CursorEncoder  // 可选，游标编码方式
+}
+
+type CursorResult[T any] struct {
+	List       []*T
+	NextCursor string // HasNext为true时有效
+	PrevCursor string // HasPrev为true时有效
+	HasNext    bool
+	HasPrev    bool
+}
+
+// CursorPaginate 基于游标（keyset）的分页，不需要COUNT和OFFSET，翻页深度不影响性能
+// 需要在传递tx时将其他查询条件先构建到tx中，但不要在tx中设置Order
+// 排序列上应该有合适的联合索引
+func CursorPaginate[T any](tx *gorm.DB, opts *CursorOpts) (*CursorResult[T], error) {
+	if len(opts.Columns) == 0 {
+		return nil, ErrNoCursorColumn
+	}
+	limit := opts.Limit
+	if limit < 1 {
+		limit = 10
+	}
+	encoder := opts.Encoder
+	if encoder == nil {
+		encoder = base64CursorEncoder{}
+	}
+	stmt, err := parseStatement[T](tx)
+	if err != nil {
+		return nil, err
+	}
+	fields, descs, err := getCursorFields(stmt.Schema, opts.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor *Cursor
+	if opts.Cursor != "" {
+		if cursor, err = encoder.Decode(opts.Cursor); err != nil {
+			return nil, err
+		}
+		if len(cursor.Values) != len(fields) {
+			return nil, ErrInvalidCursor
+		}
+	}
+	backward := cursor != nil && cursor.Prev
+
+	query := tx.Session(&gorm.Session{})
+	if cursor != nil {
+		values, err := decodeCursorValues(fields, cursor.Values)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(buildKeysetExpr(fields, descs, values, backward))
+	}
+	orderBy := clause.OrderBy{}
+	for i, field := range fields {
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+			Desc:   descs[i] != backward,
+		})
+	}
+	var list []*T
+	if err := query.Clauses(orderBy).Limit(int(limit) + 1).Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	more := len(list) > int(limit)
+	if more {
+		list = list[:limit]
+	}
+	if backward {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+	result := &CursorResult[T]{List: list}
+	if backward {
+		result.HasPrev = more
+		result.HasNext = true
+	} else {
+		result.HasNext = more
+		result.HasPrev = cursor != nil
+	}
+	if len(list) == 0 {
+		return result, nil
+	}
+	ctx := tx.Statement.Context
+	if result.HasNext {
+		if result.NextCursor, err = encodeCursor(ctx, encoder, fields, list[len(list)-1], false); err != nil {
+			return nil, err
+		}
+	}
+	if result.HasPrev {
+		if result.PrevCursor, err = encodeCursor(ctx, encoder, fields, list[0], true); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func getCursorFields(s *schema.Schema, columns []CursorColumn) (fields []*schema.Field, descs []bool, err error) {
+	hasPrimary := false
+	for _, col := range columns {
+		field := s.LookUpField(col.Column)
+		if field == nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownCursorCol, col.Column)
+		}
+		if field == s.PrioritizedPrimaryField {
+			hasPrimary = true
+		}
+		fields = append(fields, field)
+		descs = append(descs, col.Desc)
+	}
+	if !hasPrimary && s.PrioritizedPrimaryField != nil {
+		fields = append(fields, s.PrioritizedPrimaryField)
+		descs = append(descs, columns[len(columns)-1].Desc)
+	}
+	return fields, descs, nil
+}
+
+// buildKeysetExpr 构造 (a > ?) OR (a = ? AND b > ?) OR ... 形式的条件，兼容各列排序方向不同的情况
+func buildKeysetExpr(fields []*schema.Field, descs []bool, values []interface{}, backward bool) clause.Expression {
+	var ors []clause.Expression
+	for i := range fields {
+		var ands []clause.Expression
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: fields[j].DBName}, Value: values[j]})
+		}
+		column := clause.Column{Table: clause.CurrentTable, Name: fields[i].DBName}
+		if descs[i] != backward {
+			ands = append(ands, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: column, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	return clause.Or(ors...)
+}
+
+func encodeCursor(ctx context.Context, encoder CursorEncoder, fields []*schema.Field, row interface{}, prev bool) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rv := reflect.ValueOf(row)
+	cursor := &Cursor{Prev: prev}
+	for _, field := range fields {
+		value, _ := field.ValueOf(ctx, rv)
+		raw, err := jsonx.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		cursor.Values = append(cursor.Values, raw)
+	}
+	return encoder.Encode(cursor)
+}
+
+// decodeCursorValues 按照字段类型反序列化，避免大整数在json中丢失精度
+func decodeCursorValues(fields []*schema.Field, raws []json.RawMessage) ([]interface{}, error) {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		ptr := reflect.New(field.FieldType)
+		if err := jsonx.Unmarshal(raws[i], ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		values[i] = ptr.Elem().Interface()
+	}
+	return values, nil
+}
+
+type base64CursorEncoder struct{}
+
+func (base64CursorEncoder) Encode(cursor *Cursor) (string, error) {
+	data, err := jsonx.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (base64CursorEncoder) Decode(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := &Cursor{}
+	if err := jsonx.Unmarshal(data, cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// ShortIDCursorEncoder 使用sqids编码游标，生成的游标更短
+// 只适用于所有排序列都是非负整数的情况，例如自增id或者雪花id
+type ShortIDCursorEncoder struct {
+	generator *idx.ShortIDGenerator
+}
+
+func NewShortIDCursorEncoder(generator *idx.ShortIDGenerator) *ShortIDCursorEncoder {
+	return &ShortIDCursorEncoder{generator: generator}
+}
+
+func (e *ShortIDCursorEncoder) Encode(cursor *Cursor) (string, error) {
+	numbers := make([]uint64, 0, len(cursor.Values)+1)
+	if cursor.Prev {
+		numbers = append(numbers, 1)
+	} else {
+		numbers = append(numbers, 0)
+	}
+	for _, raw := range cursor.Values {
+		var n uint64
+		if err := jsonx.Unmarshal(raw, &n); err != nil {
+			return "", fmt.Errorf("%w: sqids cursor only supports unsigned integers", ErrInvalidCursor)
+		}
+		numbers = append(numbers, n)
+	}
+	return e.generator.Encode(numbers)
+}
+
+func (e *ShortIDCursorEncoder) Decode(s string) (*Cursor, error) {
+	numbers := e.generator.Decode(s)
+	if len(numbers) < 2 || numbers[0] > 1 {
+		return nil, ErrInvalidCursor
+	}
+	cursor := &Cursor{Prev: numbers[0] == 1}
+	for _, n := range numbers[1:] {
+		raw, err := jsonx.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		cursor.Values = append(cursor.Values, raw)
+	}
+	return cursor, nil
+}
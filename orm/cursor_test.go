@@ -0,0 +1,100 @@
+package orm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type testScore struct {
+	ID    uint64
+	Score int
+}
+
+func newScoreDB(t *testing.T) *gorm.DB {
+	db := New(newSQLiteConfig(t, "cursor.db"))
+	assert.NoError(t, db.AutoMigrate(&testScore{}))
+	var scores []*testScore
+	for i := 0; i < 25; i++ {
+		scores = append(scores, &testScore{Score: i % 5})
+	}
+	assert.NoError(t, db.Create(&scores).Error)
+	return db
+}
+
+func TestCursorPaginate(t *testing.T) {
+	db := newScoreDB(t)
+	opts := &CursorOpts{
+		Columns: []CursorColumn{{Column: "score", Desc: true}},
+		Limit:   10,
+	}
+	var pages []*CursorResult[testScore]
+	seen := make(map[uint64]struct{})
+	for {
+		result, err := CursorPaginate[testScore](db.Model(&testScore{}), opts)
+		assert.NoError(t, err)
+		for _, s := range result.List {
+			seen[s.ID] = struct{}{}
+		}
+		pages = append(pages, result)
+		if !result.HasNext {
+			break
+		}
+		opts.Cursor = result.NextCursor
+	}
+	assert.Len(t, pages, 3)
+	assert.Len(t, seen, 25)
+	assert.False(t, pages[0].HasPrev)
+	assert.True(t, pages[2].HasPrev)
+	assert.Len(t, pages[2].List, 5)
+
+	opts.Cursor = pages[2].PrevCursor
+	prev, err := CursorPaginate[testScore](db.Model(&testScore{}), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, pages[1].List, prev.List)
+	assert.True(t, prev.HasPrev)
+	assert.True(t, prev.HasNext)
+
+	opts.Cursor = "invalid"
+	_, err = CursorPaginate[testScore](db.Model(&testScore{}), opts)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestPaginate_WithoutCount(t *testing.T) {
+	db := newScoreDB(t)
+	result, err := Paginate[testScore](db.Model(&testScore{}), 3, 10, WithoutCount())
+	assert.NoError(t, err)
+	assert.Len(t, result.List, 5)
+	assert.False(t, result.HasNext)
+	assert.Zero(t, result.Total)
+
+	assert.NoError(t, db.Exec("ANALYZE").Error)
+	result, err = Paginate[testScore](db.Model(&testScore{}), 1, 10, WithEstimatedCount())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(25), result.Total)
+	assert.True(t, result.HasNext)
+}
+
+func TestPaginate_StaleEstimate(t *testing.T) {
+	db := New(newSQLiteConfig(t, "estimate.db"))
+	assert.NoError(t, db.AutoMigrate(&testScore{}))
+	// 没有统计信息时估算为0，仍然返回数据
+	var scores []*testScore
+	for i := 0; i < 15; i++ {
+		scores = append(scores, &testScore{Score: i})
+	}
+	assert.NoError(t, db.Create(&scores).Error)
+	result, err := Paginate[testScore](db.Model(&testScore{}), 1, 10, WithEstimatedCount())
+	assert.NoError(t, err)
+	assert.Len(t, result.List, 10)
+	assert.True(t, result.HasNext)
+	assert.Equal(t, uint64(11), result.Total)
+
+	result, err = Paginate[testScore](db.Model(&testScore{}), 2, 10, WithEstimatedCount())
+	assert.NoError(t, err)
+	assert.Len(t, result.List, 5)
+	assert.False(t, result.HasNext)
+	assert.Equal(t, uint64(15), result.Total)
+	assert.Equal(t, uint32(2), result.TotalPages)
+}
@@ -0,0 +1,58 @@
+package orm
+
+import (
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// DataSources 多数据源管理，按名称注册和获取db
+type DataSources struct {
+	mux sync.RWMutex
+	dbs map[string]*gorm.DB
+}
+
+func NewDataSources() *DataSources {
+	return &DataSources{
+		dbs: make(map[string]*gorm.DB),
+	}
+}
+
+// Register 注册数据源，名称重复会panic
+func (d *DataSources) Register(name string, db *gorm.DB) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if _, ok := d.dbs[name]; ok {
+		panic(fmt.Sprintf("data source: %s already exist", name))
+	}
+	d.dbs[name] = db
+}
+
+// Get 获取数据源，不存在时返回false
+func (d *DataSources) Get(name string) (db *gorm.DB, ok bool) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	db, ok = d.dbs[name]
+	return
+}
+
+// MustGet 获取数据源，不存在时panic
+func (d *DataSources) MustGet(name string) *gorm.DB {
+	db, ok := d.Get(name)
+	if !ok {
+		panic(fmt.Sprintf("data source: %s not found", name))
+	}
+	return db
+}
+
+// Names 返回所有已注册的数据源名称
+func (d *DataSources) Names() []string {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	names := make([]string, 0, len(d.dbs))
+	for name := range d.dbs {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,9 @@
+package orm
+
+// gorm Dialector.Name() 的返回值
+const (
+	dialectMySQL     = "mysql"
+	dialectPostgres  = "postgres"
+	dialectSQLServer = "sqlserver"
+	dialectSQLite    = "sqlite"
+)
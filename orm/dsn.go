@@ -0,0 +1,364 @@
+package orm
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
+)
+
+var ErrInvalidConfig = errors.New("orm: invalid config")
+
+// DSNOpts DbConfig之外的连接参数，通过WithDSNOpts设置
+type DSNOpts struct {
+	// SSLMode TLS模式
+	// mysql: true/false/skip-verify/preferred，设置了证书时使用证书校验
+	// postgres: disable/allow/prefer/require/verify-ca/verify-full，为空时根据DbPostgres.SslMode使用require或者disable
+	// sqlserver: disable/false/true/strict，对应encrypt参数
+	SSLMode    string
+	CACert     string // CA证书路径
+	ClientCert string // 客户端证书路径，sqlserver不支持
+	ClientKey  string // 客户端私钥路径，sqlserver不支持
+	ServerName string // 校验证书的主机名，为空时使用Host
+	// ApplicationName postgres的application_name，sqlserver的app name，mysql的连接属性program_name
+	ApplicationName string
+	ConnectTimeout  time.Duration // postgres/sqlserver的连接超时，mysql使用DbMysql.ConnTimeout
+	// Params 额外的连接参数，原样追加到DSN中，优先级最高
+	Params map[string]string
+
+	// sqlite pragma
+	JournalMode string        // 例如WAL
+	BusyTimeout time.Duration // 数据库被锁定时的等待时间
+	ForeignKeys bool          // 开启外键约束
+	Synchronous string        // OFF/NORMAL/FULL/EXTRA
+}
+
+// WithDSNOpts : 设置DbConfig之外的连接参数，例如TLS证书、application_name、sqlite pragma等
+func WithDSNOpts(dsn *DSNOpts) OpenOption {
+	return func(o *OpenOpts) {
+		if dsn != nil {
+			o.DSN = dsn
+		}
+	}
+}
+
+var (
+	mysqlSSLModes     = []string{"true", "false", "skip-verify", "preferred"}
+	postgresSSLModes  = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	sqlServerSSLModes = []string{"disable", "false", "true", "strict"}
+	sqliteSynchronous = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+	sqliteJournalMode = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+)
+
+func invalidConfig(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...))
+}
+
+func validateServer(dialect, host string, port uint32, user, dbName string) error {
+	switch {
+	case host == "":
+		return invalidConfig("%s host is required", dialect)
+	case port == 0 || port > 65535:
+		return invalidConfig("%s port %d is out of range", dialect, port)
+	case user == "":
+		return invalidConfig("%s user is required", dialect)
+	case dbName == "":
+		return invalidConfig("%s db name is required", dialect)
+	}
+	return nil
+}
+
+func validateOneOf(dialect, name, value string, values []string) error {
+	if value == "" {
+		return nil
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return nil
+		}
+	}
+	return invalidConfig("%s %s %q must be one of %s", dialect, name, value, strings.Join(values, "/"))
+}
+
+func validateCerts(dsn *DSNOpts) error {
+	if (dsn.ClientCert == "") != (dsn.ClientKey == "") {
+		return invalidConfig("client cert and client key must be set together")
+	}
+	for _, file := range []string{dsn.CACert, dsn.ClientCert, dsn.ClientKey} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return invalidConfig("cert file: %v", err)
+		}
+	}
+	return nil
+}
+
+func getMySqlDSN(config *configv1.DbMysql, dsn *DSNOpts) (string, error) {
+	if config == nil {
+		return "", invalidConfig("mysql config is required")
+	}
+	if err := validateServer(dialectMySQL, config.Host, config.Port, config.User, config.DbName); err != nil {
+		return "", err
+	}
+	if err := validateOneOf(dialectMySQL, "ssl mode", dsn.SSLMode, mysqlSSLModes); err != nil {
+		return "", err
+	}
+	if err := validateCerts(dsn); err != nil {
+		return "", err
+	}
+	loc, err := time.LoadLocation(config.Location)
+	if err != nil {
+		return "", invalidConfig("mysql location: %v", err)
+	}
+	c := mysql.NewConfig()
+	c.User = config.User
+	c.Passwd = config.Password
+	c.Net = "tcp"
+	c.Addr = net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port)))
+	c.DBName = config.DbName
+	c.ParseTime = true
+	c.Loc = loc
+	c.Timeout = time.Duration(config.ConnTimeout) * time.Second
+	c.ReadTimeout = time.Duration(config.ReadTimeout) * time.Second
+	c.WriteTimeout = time.Duration(config.WriteTimeout) * time.Second
+	c.Params = map[string]string{}
+	if config.Charset != "" {
+		c.Params["charset"] = config.Charset
+	}
+	if dsn.ApplicationName != "" {
+		c.ConnectionAttributes = "program_name:" + dsn.ApplicationName
+	}
+	if dsn.CACert != "" || dsn.ClientCert != "" {
+		// 使用证书时需要注册tls.Config，注册表是进程级别的，以证书内容区分不同的配置
+		insecure := dsn.SSLMode == "skip-verify"
+		tlsConfig, err := newTLSConfig(dsn, config.Host, insecure)
+		if err != nil {
+			return "", err
+		}
+		name, err := tlsConfigName(dsn, tlsConfig.ServerName, insecure)
+		if err != nil {
+			return "", err
+		}
+		if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+			return "", invalidConfig("mysql tls: %v", err)
+		}
+		c.TLSConfig = name
+	} else if dsn.SSLMode != "" {
+		c.TLSConfig = strings.ToLower(dsn.SSLMode)
+	}
+	for k, v := range dsn.Params {
+		c.Params[k] = v
+	}
+	return c.FormatDSN(), nil
+}
+
+// tlsConfigName 根据证书内容和校验参数生成注册tls.Config的名称，相同的配置得到相同的名称
+func tlsConfigName(dsn *DSNOpts, serverName string, insecure bool) (string, error) {
+	h := sha256.New()
+	for _, file := range []string{dsn.CACert, dsn.ClientCert, dsn.ClientKey} {
+		var content []byte
+		if file != "" {
+			var err error
+			if content, err = os.ReadFile(file); err != nil {
+				return "", invalidConfig("read cert: %v", err)
+			}
+		}
+		_, _ = fmt.Fprintf(h, "%d:%s", len(content), content)
+	}
+	_, _ = fmt.Fprintf(h, "%s:%t", serverName, insecure)
+	return "orm-" + hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+func newTLSConfig(dsn *DSNOpts, host string, insecure bool) (*tls.Config, error) {
+	serverName := dsn.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	tlsConfig := &tls.Config{ServerName: serverName, InsecureSkipVerify: insecure}
+	if dsn.CACert != "" {
+		pem, err := os.ReadFile(dsn.CACert)
+		if err != nil {
+			return nil, invalidConfig("read ca cert: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, invalidConfig("no certificate found in %s", dsn.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if dsn.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(dsn.ClientCert, dsn.ClientKey)
+		if err != nil {
+			return nil, invalidConfig("load client cert: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func getPostgresSSLMode(config *configv1.DbPostgres, dsn *DSNOpts) string {
+	if dsn.SSLMode != "" {
+		return strings.ToLower(dsn.SSLMode)
+	}
+	if config.SslMode {
+		return "require"
+	}
+	return "disable"
+}
+
+func getPostgresDSN(config *configv1.DbPostgres, dsn *DSNOpts) (string, error) {
+	if config == nil {
+		return "", invalidConfig("postgres config is required")
+	}
+	if err := validateServer(dialectPostgres, config.Host, config.Port, config.User, config.DbName); err != nil {
+		return "", err
+	}
+	if err := validateOneOf(dialectPostgres, "ssl mode", dsn.SSLMode, postgresSSLModes); err != nil {
+		return "", err
+	}
+	if err := validateCerts(dsn); err != nil {
+		return "", err
+	}
+	sslMode := getPostgresSSLMode(config, dsn)
+	if (sslMode == "verify-ca" || sslMode == "verify-full") && dsn.CACert == "" {
+		return "", invalidConfig("postgres ssl mode %s requires ca cert", sslMode)
+	}
+	params := map[string]string{
+		"host":     config.Host,
+		"port":     strconv.Itoa(int(config.Port)),
+		"user":     config.User,
+		"password": config.Password,
+		"dbname":   config.DbName,
+		"sslmode":  sslMode,
+	}
+	setIfNotEmpty(params, "TimeZone", config.TimeZone)
+	setIfNotEmpty(params, "search_path", config.Schema)
+	setIfNotEmpty(params, "sslrootcert", dsn.CACert)
+	setIfNotEmpty(params, "sslcert", dsn.ClientCert)
+	setIfNotEmpty(params, "sslkey", dsn.ClientKey)
+	setIfNotEmpty(params, "application_name", dsn.ApplicationName)
+	if dsn.ConnectTimeout > 0 {
+		params["connect_timeout"] = strconv.Itoa(int(max(dsn.ConnectTimeout/time.Second, 1)))
+	}
+	for k, v := range dsn.Params {
+		params[k] = v
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+quotePostgresValue(params[k]))
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+// quotePostgresValue 包含空格、引号、反斜杠或者为空的值需要使用单引号并转义
+func quotePostgresValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+func getSQLServerDSN(config *configv1.DbSQLServer, dsn *DSNOpts) (string, error) {
+	if config == nil {
+		return "", invalidConfig("sqlserver config is required")
+	}
+	if err := validateServer(dialectSQLServer, config.Host, config.Port, config.User, config.DbName); err != nil {
+		return "", err
+	}
+	if err := validateOneOf(dialectSQLServer, "ssl mode", dsn.SSLMode, sqlServerSSLModes); err != nil {
+		return "", err
+	}
+	if err := validateCerts(dsn); err != nil {
+		return "", err
+	}
+	if dsn.ClientCert != "" {
+		return "", invalidConfig("sqlserver does not support client cert")
+	}
+	query := url.Values{}
+	query.Set("database", config.DbName)
+	setQuery(query, "encrypt", strings.ToLower(dsn.SSLMode))
+	setQuery(query, "certificate", dsn.CACert)
+	setQuery(query, "hostNameInCertificate", dsn.ServerName)
+	setQuery(query, "app name", dsn.ApplicationName)
+	if dsn.ConnectTimeout > 0 {
+		seconds := strconv.Itoa(int(max(dsn.ConnectTimeout/time.Second, 1)))
+		query.Set("connection timeout", seconds)
+		query.Set("dial timeout", seconds)
+	}
+	for k, v := range dsn.Params {
+		query.Set(k, v)
+	}
+	u := &url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
+		RawQuery: query.Encode(),
+	}
+	return u.String(), nil
+}
+
+func getSqliteDSN(config *configv1.DbSQLite, dsn *DSNOpts) (string, error) {
+	if config == nil || config.DbPath == "" {
+		return "", invalidConfig("sqlite db path is required")
+	}
+	if err := validateOneOf(dialectSQLite, "journal mode", dsn.JournalMode, sqliteJournalMode); err != nil {
+		return "", err
+	}
+	if err := validateOneOf(dialectSQLite, "synchronous", dsn.Synchronous, sqliteSynchronous); err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	setQuery(query, "_journal_mode", strings.ToUpper(dsn.JournalMode))
+	setQuery(query, "_synchronous", strings.ToUpper(dsn.Synchronous))
+	if dsn.BusyTimeout > 0 {
+		query.Set("_busy_timeout", strconv.FormatInt(dsn.BusyTimeout.Milliseconds(), 10))
+	}
+	if dsn.ForeignKeys {
+		query.Set("_foreign_keys", "1")
+	}
+	for k, v := range dsn.Params {
+		query.Set(k, v)
+	}
+	if len(query) == 0 {
+		return config.DbPath, nil
+	}
+	sep := "?"
+	if strings.Contains(config.DbPath, "?") {
+		sep = "&"
+	}
+	return config.DbPath + sep + query.Encode(), nil
+}
+
+func setIfNotEmpty(params map[string]string, key, value string) {
+	if value != "" {
+		params[key] = value
+	}
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
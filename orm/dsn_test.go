@@ -0,0 +1,121 @@
+package orm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+
+	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
+)
+
+func TestGetPostgresDSN(t *testing.T) {
+	config := &configv1.DbPostgres{
+		Host:     "localhost",
+		User:     "root",
+		Password: "p@ss word'",
+		DbName:   "app",
+		Port:     5432,
+		TimeZone: "Asia/Shanghai",
+	}
+	dsn, err := getPostgresDSN(config, &DSNOpts{ApplicationName: "api", ConnectTimeout: 3 * time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, `TimeZone=Asia/Shanghai application_name=api connect_timeout=3 dbname=app host=localhost `+
+		`password='p@ss word\'' port=5432 sslmode=disable user=root`, dsn)
+
+	_, err = getPostgresDSN(config, &DSNOpts{SSLMode: "enable"})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = getPostgresDSN(config, &DSNOpts{SSLMode: "verify-full"})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = getPostgresDSN(&configv1.DbPostgres{Host: "localhost", User: "root", DbName: "app"}, &DSNOpts{})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestGetMySqlDSN(t *testing.T) {
+	config := &configv1.DbMysql{
+		User:        "root",
+		Password:    "secret",
+		Host:        "localhost",
+		Port:        3306,
+		DbName:      "app",
+		Charset:     "utf8mb4",
+		Location:    "Asia/Shanghai",
+		ConnTimeout: 5,
+	}
+	dsn, err := getMySqlDSN(config, &DSNOpts{SSLMode: "preferred"})
+	assert.NoError(t, err)
+	assert.Equal(t, "root:secret@tcp(localhost:3306)/app?loc=Asia%2FShanghai&parseTime=true&timeout=5s&tls=preferred&charset=utf8mb4", dsn)
+
+	config.Location = "Mars/Olympus"
+	_, err = getMySqlDSN(config, &DSNOpts{})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestGetSQLServerDSN(t *testing.T) {
+	config := &configv1.DbSQLServer{User: "sa", Password: "a@b", Host: "db", Port: 1433, DbName: "app"}
+	dsn, err := getSQLServerDSN(config, &DSNOpts{SSLMode: "true", ConnectTimeout: 10 * time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, "sqlserver://sa:a%40b@db:1433?connection+timeout=10&database=app&dial+timeout=10&encrypt=true", dsn)
+}
+
+func TestGetSqliteDSN(t *testing.T) {
+	dsn, err := getSqliteDSN(&configv1.DbSQLite{DbPath: "app.db"}, &DSNOpts{
+		JournalMode: "wal",
+		BusyTimeout: 5 * time.Second,
+		ForeignKeys: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "app.db?_busy_timeout=5000&_foreign_keys=1&_journal_mode=WAL", dsn)
+	_, err = getSqliteDSN(&configv1.DbSQLite{}, &DSNOpts{})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func writeTestCert(t *testing.T, name string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), name+".pem")
+	assert.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return file
+}
+
+func TestGetMySqlDSN_TLS(t *testing.T) {
+	config := &configv1.DbMysql{User: "root", Host: "localhost", Port: 3306, DbName: "app"}
+	// 同一个地址使用不同的CA时注册不同的tls.Config
+	primary, err := getMySqlDSN(config, &DSNOpts{CACert: writeTestCert(t, "primary")})
+	assert.NoError(t, err)
+	replica, err := getMySqlDSN(config, &DSNOpts{CACert: writeTestCert(t, "replica")})
+	assert.NoError(t, err)
+	primaryConfig, err := mysql.ParseDSN(primary)
+	assert.NoError(t, err)
+	replicaConfig, err := mysql.ParseDSN(replica)
+	assert.NoError(t, err)
+	assert.NotEqual(t, primaryConfig.TLSConfig, replicaConfig.TLSConfig)
+	assert.NotEqual(t, primaryConfig.TLS.RootCAs, replicaConfig.TLS.RootCAs)
+}
+
+func TestGetSQLServerDSN_ClientCert(t *testing.T) {
+	config := &configv1.DbSQLServer{User: "sa", Host: "db", Port: 1433, DbName: "app"}
+	cert := writeTestCert(t, "client")
+	_, err := getSQLServerDSN(config, &DSNOpts{ClientCert: cert, ClientKey: cert})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
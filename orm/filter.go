@@ -0,0 +1,293 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// FilterOp 过滤条件的操作符
+type FilterOp string
+
+const (
+	OpEq    FilterOp = "eq"
+	OpNe    FilterOp = "ne"
+	OpIn    FilterOp = "in"
+	OpNotIn FilterOp = "nin"
+	OpGt    FilterOp = "gt"
+	OpGte   FilterOp = "gte"
+	OpLt    FilterOp = "lt"
+	OpLte   FilterOp = "lte"
+	OpLike  FilterOp = "like"
+	OpNull  FilterOp = "null" // Value为true时 IS NULL，false时 IS NOT NULL
+)
+
+var (
+	ErrInvalidFilter       = errors.New("orm: invalid filter")
+	ErrUnknownFilterColumn = errors.New("orm: unknown filter column")
+)
+
+var columnRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Condition 单个过滤条件
+type Condition struct {
+	Column string
+	Op     FilterOp
+	Value  any
+}
+
+// Filter 过滤条件，多个条件之间为AND关系
+// 列名会经过校验并由gorm转义，值全部作为参数传递，不会拼接到SQL中
+type Filter []Condition
+
+func Eq(column string, value any) Condition {
+	return Condition{Column: column, Op: OpEq, Value: value}
+}
+
+func Ne(column string, value any) Condition {
+	return Condition{Column: column, Op: OpNe, Value: value}
+}
+
+func In(column string, values any) Condition {
+	return Condition{Column: column, Op: OpIn, Value: values}
+}
+
+func NotIn(column string, values any) Condition {
+	return Condition{Column: column, Op: OpNotIn, Value: values}
+}
+
+func Gt(column string, value any) Condition {
+	return Condition{Column: column, Op: OpGt, Value: value}
+}
+
+func Gte(column string, value any) Condition {
+	return Condition{Column: column, Op: OpGte, Value: value}
+}
+
+func Lt(column string, value any) Condition {
+	return Condition{Column: column, Op: OpLt, Value: value}
+}
+
+func Lte(column string, value any) Condition {
+	return Condition{Column: column, Op: OpLte, Value: value}
+}
+
+// Like value为完整的匹配模式，需要调用方自行添加%
+func Like(column string, pattern string) Condition {
+	return Condition{Column: column, Op: OpLike, Value: pattern}
+}
+
+func IsNull(column string, null bool) Condition {
+	return Condition{Column: column, Op: OpNull, Value: null}
+}
+
+// Range 区间条件 min <= column <= max，min或max为nil时忽略对应的边界
+func Range(column string, min, max any) Filter {
+	var f Filter
+	if !isNil(min) {
+		f = append(f, Gte(column, min))
+	}
+	if !isNil(max) {
+		f = append(f, Lte(column, max))
+	}
+	return f
+}
+
+// NewFilter 从多个条件或者Filter构建Filter
+func NewFilter(conds ...any) Filter {
+	var f Filter
+	for _, c := range conds {
+		switch v := c.(type) {
+		case Condition:
+			f = append(f, v)
+		case Filter:
+			f = append(f, v...)
+		}
+	}
+	return f
+}
+
+// ParseFilter 将struct或者map转换为Filter
+// struct字段使用tag `filter:"column,op"`，省略column时使用字段名的蛇形命名，省略op时切片为in，其他为eq
+// nil指针、空切片和零值字段会被忽略，需要按零值过滤时使用指针
+// map的key为列名或者 列名__op，例如 {"name": "a", "age__gte": 18, "id__in": []int{1, 2}}
+func ParseFilter(v any) (Filter, error) {
+	switch value := v.(type) {
+	case nil:
+		return nil, nil
+	case Filter:
+		return value, nil
+	case map[string]any:
+		return parseMapFilter(value)
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: unsupported type %T", ErrInvalidFilter, v)
+	}
+	var f Filter
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("filter")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.IsZero() || ((fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map) && fv.Len() == 0) {
+			continue
+		}
+		column, op, _ := strings.Cut(tag, ",")
+		if column == "" {
+			column = schema.NamingStrategy{}.ColumnName("", sf.Name)
+		}
+		value := reflect.Indirect(fv).Interface()
+		f = append(f, Condition{Column: column, Op: defaultOp(FilterOp(op), value), Value: value})
+	}
+	return f, nil
+}
+
+func parseMapFilter(m map[string]any) (Filter, error) {
+	f := make(Filter, 0, len(m))
+	for key, value := range m {
+		column, op := key, FilterOp("")
+		if i := strings.LastIndex(key, "__"); i > 0 {
+			column, op = key[:i], FilterOp(key[i+2:])
+		}
+		f = append(f, Condition{Column: column, Op: defaultOp(op, value), Value: value})
+	}
+	// map遍历无序，排序保证生成的SQL稳定
+	sort.Slice(f, func(i, j int) bool {
+		if f[i].Column != f[j].Column {
+			return f[i].Column < f[j].Column
+		}
+		return f[i].Op < f[j].Op
+	})
+	return f, nil
+}
+
+func defaultOp(op FilterOp, value any) FilterOp {
+	if op != "" {
+		return op
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		return OpIn
+	}
+	return OpEq
+}
+
+// Scope 将Filter作为gorm scope使用，用法：db.Scopes(filter.Scope).Find(&users)
+func (f Filter) Scope(db *gorm.DB) *gorm.DB {
+	exprs, err := f.Build()
+	if err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	if len(exprs) == 0 {
+		return db
+	}
+	return db.Where(clause.And(exprs...))
+}
+
+// Build 转换为gorm的clause表达式
+func (f Filter) Build() ([]clause.Expression, error) {
+	exprs := make([]clause.Expression, 0, len(f))
+	for _, c := range f {
+		expr, err := c.Build()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs, nil
+}
+
+// Validate 校验列名是否都存在于model中
+func (f Filter) Validate(s *schema.Schema) error {
+	for _, c := range f {
+		name := c.Column
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		if s.LookUpField(name) == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownFilterColumn, c.Column)
+		}
+	}
+	return nil
+}
+
+func (c Condition) Build() (clause.Expression, error) {
+	if !columnRegexp.MatchString(c.Column) {
+		return nil, fmt.Errorf("%w: invalid column %q", ErrInvalidFilter, c.Column)
+	}
+	column := clause.Column{Name: c.Column}
+	if table, name, ok := strings.Cut(c.Column, "."); ok {
+		column = clause.Column{Table: table, Name: name}
+	}
+	switch c.Op {
+	case OpEq, "":
+		return clause.Eq{Column: column, Value: c.Value}, nil
+	case OpNe:
+		return clause.Neq{Column: column, Value: c.Value}, nil
+	case OpIn, OpNotIn:
+		values, err := toValues(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFilter, c.Column, err)
+		}
+		if c.Op == OpNotIn {
+			return clause.Not(clause.IN{Column: column, Values: values}), nil
+		}
+		return clause.IN{Column: column, Values: values}, nil
+	case OpGt:
+		return clause.Gt{Column: column, Value: c.Value}, nil
+	case OpGte:
+		return clause.Gte{Column: column, Value: c.Value}, nil
+	case OpLt:
+		return clause.Lt{Column: column, Value: c.Value}, nil
+	case OpLte:
+		return clause.Lte{Column: column, Value: c.Value}, nil
+	case OpLike:
+		return clause.Like{Column: column, Value: c.Value}, nil
+	case OpNull:
+		null, ok := c.Value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: null expects bool", ErrInvalidFilter, c.Column)
+		}
+		if null {
+			return clause.Expr{SQL: "? IS NULL", Vars: []any{column}}, nil
+		}
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []any{column}}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidFilter, c.Op)
+	}
+}
+
+func toValues(v any) ([]any, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("in expects slice, got %T", v)
+	}
+	values := make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, nil
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return rv.IsNil()
+	}
+	return false
+}
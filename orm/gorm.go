@@ -1,38 +1,131 @@
 package orm
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 	"gorm.io/rawsql"
 
 	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
 	enumv1 "github.com/byteflowing/proto/gen/go/enums/v1"
 )
 
-func New(c *configv1.DbConfig) *gorm.DB {
+var ErrUnknownDbType = errors.New("unknown database type")
+
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+)
+
+type OpenOpts struct {
+	Retries        int           // 首次连接失败后的重试次数，默认不重试
+	InitialBackoff time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxBackoff     time.Duration // 最大等待时间
+	// Logger 根据DbConfig.Log创建gorm日志，为空时使用标准库log输出
+	Logger func(config *configv1.DbLog) logger.Interface
+	DSN    *DSNOpts // DbConfig之外的连接参数
+}
+
+type OpenOption func(o *OpenOpts)
+
+// WithRetry : 设置首次连接失败后的重试次数和退避时间
+func WithRetry(retries int, initialBackoff, maxBackoff time.Duration) OpenOption {
+	return func(o *OpenOpts) {
+		o.Retries = retries
+		if initialBackoff > 0 {
+			o.InitialBackoff = initialBackoff
+		}
+		if maxBackoff > 0 {
+			o.MaxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithZapLogger : 使用基于logx/zap的结构化日志代替标准库log
+// z为nil时使用logx的标准logger，日志级别、慢查询阈值等仍然读取DbConfig.Log
+func WithZapLogger(z *zap.Logger) OpenOption {
+	return func(o *OpenOpts) {
+		o.Logger = func(config *configv1.DbLog) logger.Interface {
+			return NewZapLogger(z, config)
+		}
+	}
+}
+
+// New 创建db，失败时panic，options与Open相同，例如WithDSNOpts
+func New(c *configv1.DbConfig, options ...OpenOption) *gorm.DB {
+	db, err := Open(context.Background(), c, options...)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Open 创建db，连接失败时按照WithRetry设置的次数重试，重试期间ctx取消会立即返回
+func Open(ctx context.Context, c *configv1.DbConfig, options ...OpenOption) (*gorm.DB, error) {
+	opts := &OpenOpts{
+		InitialBackoff: defaultInitialBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+		DSN:            &DSNOpts{},
+	}
+	for _, op := range options {
+		op(opts)
+	}
 	var db *gorm.DB
-	switch c.DbType {
-	case enumv1.DbType_DB_TYPE_MYSQL:
-		db = initMySQL(c)
-	case enumv1.DbType_DB_TYPE_POSTGRES:
-		db = initPostgres(c)
-	case enumv1.DbType_DB_TYPE_SQLSERVER:
-		db = initSQLServer(c)
-	case enumv1.DbType_DB_TYPE_SQLITE:
-		db = initSQLite(c)
-	default:
-		panic("unknown database type:" + c.DbType.String())
+	var err error
+	backoff := opts.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		db, err = open(c, opts)
+		if err == nil {
+			break
+		}
+		// gorm.Open在Ping失败时会返回未关闭的db，不关闭会泄露连接池
+		closeDB(db)
+		if errors.Is(err, ErrUnknownDbType) || errors.Is(err, ErrInvalidConfig) || attempt >= opts.Retries {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, opts.MaxBackoff)
+	}
+	if err != nil {
+		return nil, err
 	}
 	if c.DbType != enumv1.DbType_DB_TYPE_SQLITE && c.Conn != nil {
 		sqlDb, err := db.DB()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		sqlDb.SetConnMaxIdleTime(getMaxIdleTime(c.Conn))
 		sqlDb.SetConnMaxLifetime(getConnMaxLifetime(c.Conn))
 		sqlDb.SetMaxIdleConns(getMaxIdleConnes(c.Conn))
 		sqlDb.SetMaxOpenConns(getMaxOpenConnes(c.Conn))
 	}
-	return db
+	return db, nil
+}
+
+func open(c *configv1.DbConfig, opts *OpenOpts) (*gorm.DB, error) {
+	switch c.DbType {
+	case enumv1.DbType_DB_TYPE_MYSQL:
+		return initMySQL(c, opts)
+	case enumv1.DbType_DB_TYPE_POSTGRES:
+		return initPostgres(c, opts)
+	case enumv1.DbType_DB_TYPE_SQLSERVER:
+		return initSQLServer(c, opts)
+	case enumv1.DbType_DB_TYPE_SQLITE:
+		return initSQLite(c, opts)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDbType, c.DbType.String())
+	}
 }
 
 // NewBySQL 通过SQL创建db,主要用于gen生成struct
@@ -52,13 +145,13 @@ func NewBySQL(c *configv1.SqlConfig) *gorm.DB {
 func getDBType(t enumv1.DbType) string {
 	switch t {
 	case enumv1.DbType_DB_TYPE_MYSQL:
-		return "mysql"
+		return dialectMySQL
 	case enumv1.DbType_DB_TYPE_POSTGRES:
-		return "postgres"
+		return dialectPostgres
 	case enumv1.DbType_DB_TYPE_SQLSERVER:
-		return "sqlserver"
+		return dialectSQLServer
 	case enumv1.DbType_DB_TYPE_SQLITE:
-		return "sqlite"
+		return dialectSQLite
 	default:
 		panic("unknown database type:" + t.String())
 	}
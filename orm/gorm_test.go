@@ -0,0 +1,48 @@
+package orm
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
+	enumv1 "github.com/byteflowing/proto/gen/go/enums/v1"
+)
+
+func newBadSQLiteConfig(t *testing.T) *configv1.DbConfig {
+	return &configv1.DbConfig{
+		DbType: enumv1.DbType_DB_TYPE_SQLITE,
+		Sqlite: &configv1.DbSQLite{DbPath: filepath.Join(t.TempDir(), "missing", "app.db")},
+	}
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, newSQLiteConfig(t, "open.db"))
+	assert.NoError(t, err)
+	assert.NoError(t, Ping(ctx, db))
+	stats, err := Stats(db)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, stats.OpenConnections, 1)
+
+	_, err = Open(ctx, &configv1.DbConfig{})
+	assert.ErrorIs(t, err, ErrUnknownDbType)
+}
+
+func TestOpen_Retry(t *testing.T) {
+	start := time.Now()
+	_, err := Open(context.Background(), newBadSQLiteConfig(t), WithRetry(2, 20*time.Millisecond, 30*time.Millisecond))
+	assert.Error(t, err)
+	// 两次重试分别等待20ms和30ms
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = Open(ctx, newBadSQLiteConfig(t), WithRetry(10, time.Second, time.Second))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,51 @@
+package orm
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PoolStats 连接池状态，对应sql.DBStats
+type PoolStats struct {
+	MaxOpenConnections int           `json:"maxOpenConnections"` // 最大连接数
+	OpenConnections    int           `json:"openConnections"`    // 当前连接数，包括使用中和空闲的
+	InUse              int           `json:"inUse"`              // 使用中的连接数
+	Idle               int           `json:"idle"`               // 空闲连接数
+	WaitCount          int64         `json:"waitCount"`          // 等待连接的总次数
+	WaitDuration       time.Duration `json:"waitDuration"`       // 等待连接的总时长
+	MaxIdleClosed      int64         `json:"maxIdleClosed"`      // 因为SetMaxIdleConns关闭的连接数
+	MaxIdleTimeClosed  int64         `json:"maxIdleTimeClosed"`  // 因为SetConnMaxIdleTime关闭的连接数
+	MaxLifetimeClosed  int64         `json:"maxLifetimeClosed"`  // 因为SetConnMaxLifetime关闭的连接数
+}
+
+// Ping 检查数据库连接是否可用，可用于readiness检查
+// 建议通过ctx设置超时时间
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Stats 返回连接池状态
+func Stats(db *gorm.DB) (*PoolStats, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	stats := sqlDB.Stats()
+	return &PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration,
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}, nil
+}
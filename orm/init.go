@@ -13,45 +13,47 @@ import (
 	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
 )
 
-func initMySQL(c *configv1.DbConfig) *gorm.DB {
-	db, err := gorm.Open(mysql.Open(getMySqlDSN(c.Mysql)), getGormConfig(c))
+func initMySQL(c *configv1.DbConfig, opts *OpenOpts) (*gorm.DB, error) {
+	dsn, err := getMySqlDSN(c.Mysql, opts.DSN)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return db
+	return gorm.Open(mysql.Open(dsn), getGormConfig(c, opts))
 }
 
-func initPostgres(c *configv1.DbConfig) *gorm.DB {
-	db, err := gorm.Open(postgres.Open(getPostgresDSN(c.Postgres)), getGormConfig(c))
+func initPostgres(c *configv1.DbConfig, opts *OpenOpts) (*gorm.DB, error) {
+	dsn, err := getPostgresDSN(c.Postgres, opts.DSN)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return db
+	return gorm.Open(postgres.Open(dsn), getGormConfig(c, opts))
 }
 
-func initSQLServer(c *configv1.DbConfig) *gorm.DB {
-	db, err := gorm.Open(sqlserver.Open(getSQLServerDSN(c.Sqlserver)), getGormConfig(c))
+func initSQLServer(c *configv1.DbConfig, opts *OpenOpts) (*gorm.DB, error) {
+	dsn, err := getSQLServerDSN(c.Sqlserver, opts.DSN)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return db
+	return gorm.Open(sqlserver.Open(dsn), getGormConfig(c, opts))
 }
 
-func initSQLite(c *configv1.DbConfig) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(getSqliteDSN(c.Sqlite)), getGormConfig(c))
+func initSQLite(c *configv1.DbConfig, opts *OpenOpts) (*gorm.DB, error) {
+	dsn, err := getSqliteDSN(c.Sqlite, opts.DSN)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return db
+	return gorm.Open(sqlite.Open(dsn), getGormConfig(c, opts))
 }
 
-func getGormConfig(c *configv1.DbConfig) *gorm.Config {
+func getGormConfig(c *configv1.DbConfig, opts *OpenOpts) *gorm.Config {
 	config := &gorm.Config{
 		SkipDefaultTransaction: true,
 		PrepareStmt:            true,
 		Logger:                 logger.Default,
 	}
-	if c.Log == nil {
+	if opts.Logger != nil {
+		config.Logger = opts.Logger(c.Log)
+	} else if c.Log == nil {
 		config.Logger = logger.Default.LogMode(logger.Silent)
 	} else {
 		config.Logger = logger.New(log.New(getLogWriter(c.Log), "\r\n", log.LstdFlags), getLogConfig(c.Log))
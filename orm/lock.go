@@ -0,0 +1,185 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	optimisticLockPluginName = "orm:optimistic_lock"
+	defaultVersionColumn     = "version"
+	skipOptimisticLockKey    = "orm:skip_optimistic_lock"
+	lockedVersionKey         = "orm:locked_version"
+	conflictRetryBackoff     = 10 * time.Millisecond
+)
+
+// ErrConflict 乐观锁冲突，记录已经被其他请求修改或者删除
+var ErrConflict = errors.New("orm: optimistic lock conflict")
+
+// SkipOptimisticLock 跳过乐观锁的scope，用法：db.Scopes(orm.SkipOptimisticLock).Updates(&p)
+func SkipOptimisticLock(db *gorm.DB) *gorm.DB {
+	return db.Set(skipOptimisticLockKey, true)
+}
+
+// OptimisticLockPlugin 乐观锁，对包含整数版本列的model生效
+// 创建时版本为0则设置为1；根据model更新时追加 WHERE version = ? 并将版本加1，
+// 没有更新到记录时返回ErrConflict，更新成功后model中的版本同步加1
+// 版本为0表示model不是从数据库中读取的，不做校验，使用map更新时仍然会将版本加1
+// 用法：db.Use(orm.NewOptimisticLockPlugin())
+type OptimisticLockPlugin struct {
+	Column string
+}
+
+func NewOptimisticLockPlugin() *OptimisticLockPlugin {
+	return &OptimisticLockPlugin{Column: defaultVersionColumn}
+}
+
+func (p *OptimisticLockPlugin) Name() string {
+	return optimisticLockPluginName
+}
+
+func (p *OptimisticLockPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register(optimisticLockPluginName, p.beforeCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(optimisticLockPluginName, p.beforeUpdate); err != nil {
+		return err
+	}
+	return cb.Update().After("gorm:update").Register(optimisticLockPluginName+":after", p.afterUpdate)
+}
+
+func (p *OptimisticLockPlugin) versionField(db *gorm.DB) *schema.Field {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil
+	}
+	if v, ok := db.Get(skipOptimisticLockKey); ok && v == true {
+		return nil
+	}
+	field := db.Statement.Schema.LookUpField(p.Column)
+	if field == nil {
+		return nil
+	}
+	switch field.FieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field
+	}
+	return nil
+}
+
+func (p *OptimisticLockPlugin) beforeCreate(db *gorm.DB) {
+	if field := p.versionField(db); field != nil {
+		setFieldIfZero(db, field, 1)
+	}
+}
+
+func (p *OptimisticLockPlugin) beforeUpdate(db *gorm.DB) {
+	field := p.versionField(db)
+	if field == nil {
+		return
+	}
+	stmt := db.Statement
+	version := int64(0)
+	if stmt.ReflectValue.Kind() == reflect.Struct {
+		if v, zero := field.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+			version = reflect.ValueOf(v).Convert(reflect.TypeOf(version)).Int()
+		}
+	}
+	if version == 0 {
+		// 版本未知时只能在map更新中使用表达式自增
+		if _, ok := stmt.Dest.(map[string]interface{}); ok {
+			stmt.SetColumn(field.DBName, gorm.Expr("? + 1", clause.Column{Name: field.DBName}), true)
+			selectColumn(stmt, field.DBName)
+		}
+		return
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: version},
+	}})
+	stmt.SetColumn(field.DBName, version+1, true)
+	selectColumn(stmt, field.DBName)
+	db.InstanceSet(lockedVersionKey, version)
+}
+
+func (p *OptimisticLockPlugin) afterUpdate(db *gorm.DB) {
+	v, ok := db.InstanceGet(lockedVersionKey)
+	if !ok || db.Error != nil {
+		return
+	}
+	version := v.(int64)
+	if db.RowsAffected == 0 {
+		_ = db.AddError(fmt.Errorf("%w: %s version %d", ErrConflict, db.Statement.Table, version))
+		return
+	}
+	if field := p.versionField(db); field != nil && db.Statement.ReflectValue.CanAddr() {
+		_ = db.AddError(field.Set(db.Statement.Context, db.Statement.ReflectValue, version+1))
+	}
+}
+
+// selectColumn 使用Select限定更新列时，把版本列加入到Select中
+func selectColumn(stmt *gorm.Statement, column string) {
+	if len(stmt.Selects) == 0 {
+		return
+	}
+	for _, s := range stmt.Selects {
+		if s == "*" || s == column {
+			return
+		}
+	}
+	stmt.Selects = append(stmt.Selects, column)
+}
+
+// RetryOnConflict 执行fn，遇到乐观锁冲突、死锁和序列化失败时重试，最多执行attempts次
+// fn应该包含完整的读取-修改-写入过程（通常是一个WithTx），不能在外层事务中调用
+func RetryOnConflict(ctx context.Context, attempts int, fn func(ctx context.Context) error) error {
+	var err error
+	backoff := conflictRetryBackoff
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil || !IsRetryable(err) || attempt >= attempts {
+			return err
+		}
+		// 加入随机抖动，避免冲突的请求同时重试再次冲突
+		timer := time.NewTimer(backoff/2 + rand.N(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// IsRetryable 是否为可以通过重试解决的错误
+// 包括ErrConflict，mysql死锁(1213)，postgres序列化失败(40001)和死锁(40P01)，sqlserver死锁(1205)
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrConflict) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213
+	}
+	// pgconn.PgError
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		state := pgErr.SQLState()
+		return state == "40001" || state == "40P01"
+	}
+	// mssql.Error
+	var mssqlErr interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &mssqlErr) {
+		return mssqlErr.SQLErrorNumber() == 1205
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type testStock struct {
+	ID      uint64
+	Amount  int
+	Version int64
+}
+
+func TestOptimisticLock(t *testing.T) {
+	db := New(newSQLiteConfig(t, "lock.db"))
+	assert.NoError(t, db.Use(NewOptimisticLockPlugin()))
+	assert.NoError(t, db.AutoMigrate(&testStock{}))
+	ctx := context.Background()
+
+	stock := &testStock{Amount: 10}
+	assert.NoError(t, db.Create(stock).Error)
+	assert.Equal(t, int64(1), stock.Version)
+
+	stale := *stock
+	stock.Amount = 9
+	assert.NoError(t, db.Save(stock).Error)
+	assert.Equal(t, int64(2), stock.Version)
+	assert.NoError(t, db.Model(stock).Update("amount", 8).Error)
+	assert.Equal(t, int64(3), stock.Version)
+
+	stale.Amount = 100
+	assert.ErrorIs(t, db.Model(&stale).Select("amount").Updates(&stale).Error, ErrConflict)
+
+	attempts := 0
+	err := RetryOnConflict(ctx, 3, func(ctx context.Context) error {
+		attempts++
+		var s testStock
+		if err := db.WithContext(ctx).First(&s, stock.ID).Error; err != nil {
+			return err
+		}
+		if attempts == 1 {
+			// 模拟并发修改
+			if err := db.Model(&testStock{}).Where("id = ?", s.ID).Update("amount", 7).Error; err != nil {
+				return err
+			}
+		}
+		return db.WithContext(ctx).Model(&s).Update("amount", gorm.Expr("amount - 1")).Error
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	var got testStock
+	assert.NoError(t, db.First(&got, stock.ID).Error)
+	assert.Equal(t, 6, got.Amount)
+	assert.Equal(t, int64(5), got.Version)
+
+	err = RetryOnConflict(ctx, 2, func(ctx context.Context) error { return ErrConflict })
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.False(t, IsRetryable(errors.New("other")))
+}
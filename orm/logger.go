@@ -0,0 +1,169 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/byteflowing/go-common/logx"
+	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
+)
+
+const defaultSlowThreshold = 200 * time.Millisecond
+
+// ormSourceDir 本包的目录，查找调用位置时跳过本包和gorm的代码
+var ormSourceDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file) + "/"
+}()
+
+// ZapLogger 基于logx/zap的gorm日志，以结构化字段输出sql、影响行数、耗时和调用位置
+// 会自动带上ctx中的log id
+type ZapLogger struct {
+	logger                    *lazyLogger
+	level                     logger.LogLevel
+	slowThreshold             time.Duration
+	ignoreRecordNotFoundError bool
+	parameterizedQueries      bool
+}
+
+// NewZapLogger 创建gorm日志
+// z为nil时使用logx的标准logger；config为nil时只记录错误和慢查询
+func NewZapLogger(z *zap.Logger, config *configv1.DbLog) *ZapLogger {
+	l := &ZapLogger{
+		logger:        &lazyLogger{z: z},
+		level:         logger.Warn,
+		slowThreshold: defaultSlowThreshold,
+	}
+	if config != nil {
+		l.level = getLogLevel(config)
+		l.slowThreshold = time.Duration(config.SlowThreshold) * time.Millisecond
+		l.ignoreRecordNotFoundError = config.IgnoreRecordNotFoundErr
+		l.parameterizedQueries = config.ParameterizedQueries
+	}
+	return l
+}
+
+func (l *ZapLogger) LogMode(level logger.LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.level = level
+	return &newLogger
+}
+
+func (l *ZapLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		l.getLogger().Info(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *ZapLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		l.getLogger().Warn(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *ZapLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		l.getLogger().Error(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *ZapLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.level >= logger.Error && (!errors.Is(err, gorm.ErrRecordNotFound) || !l.ignoreRecordNotFoundError):
+		sql, rows := fc()
+		l.getLogger().Error("sql error", l.traceFields(ctx, sql, rows, elapsed, zap.Error(err))...)
+	case l.slowThreshold != 0 && elapsed > l.slowThreshold && l.level >= logger.Warn:
+		sql, rows := fc()
+		l.getLogger().Warn("slow sql", l.traceFields(ctx, sql, rows, elapsed, zap.Duration("threshold", l.slowThreshold))...)
+	case l.level == logger.Info:
+		sql, rows := fc()
+		l.getLogger().Info("sql", l.traceFields(ctx, sql, rows, elapsed)...)
+	}
+}
+
+// ParamsFilter 开启ParameterizedQueries时日志中不输出参数
+func (l *ZapLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.parameterizedQueries {
+		return sql, nil
+	}
+	return sql, params
+}
+
+func (l *ZapLogger) getLogger() *zap.Logger {
+	return l.logger.get()
+}
+
+func (l *ZapLogger) fields(ctx context.Context, fields ...zap.Field) []zap.Field {
+	return logx.CtxFields(ctx, append(fields, zap.String("caller", callerLocation()))...)
+}
+
+// lazyLogger 第一次使用时创建logger，logx可能在NewZapLogger之后才初始化；LogMode复制的实例共享同一个logger
+type lazyLogger struct {
+	once sync.Once
+	z    *zap.Logger
+}
+
+func (l *lazyLogger) get() *zap.Logger {
+	l.once.Do(func() {
+		if l.z == nil {
+			l.z = logx.GetStdLogger()
+		}
+		// 调用位置由caller字段记录，zap自身的caller只会指向本文件
+		l.z = l.z.WithOptions(zap.WithCaller(false))
+	})
+	return l.z
+}
+
+// callerLocation 返回第一个不在gorm和本包中的调用位置，本包的测试文件除外
+func callerLocation() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isInternalFrame(frame.File) {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func isInternalFrame(file string) bool {
+	if strings.Contains(file, "/gorm.io/") {
+		return true
+	}
+	if strings.HasPrefix(file, ormSourceDir) && !strings.Contains(file[len(ormSourceDir):], "/") {
+		return !strings.HasSuffix(file, "_test.go")
+	}
+	return false
+}
+
+func (l *ZapLogger) traceFields(ctx context.Context, sql string, rows int64, elapsed time.Duration, extra ...zap.Field) []zap.Field {
+	fields := make([]zap.Field, 0, 4+len(extra))
+	fields = append(fields, zap.String("sql", sql))
+	if rows == -1 {
+		fields = append(fields, zap.String("rows", "-"))
+	} else {
+		fields = append(fields, zap.Int64("rows", rows))
+	}
+	fields = append(fields, zap.Duration("latency", elapsed))
+	fields = append(fields, extra...)
+	return l.fields(ctx, fields...)
+}
@@ -0,0 +1,40 @@
+package orm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
+	enumv1 "github.com/byteflowing/proto/gen/go/enums/v1"
+)
+
+func TestZapLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	c := newSQLiteConfig(t, "logger.db")
+	c.Log = &configv1.DbLog{
+		Level:                   enumv1.DbLogLevel_DB_LOG_LEVEL_INFO,
+		IgnoreRecordNotFoundErr: true,
+		ParameterizedQueries:    true,
+	}
+	db, err := Open(context.Background(), c, WithZapLogger(zap.New(core)))
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&testUser{}))
+
+	logs.TakeAll()
+	var user testUser
+	err = db.Where("name = ?", "nobody").First(&user).Error
+	assert.Error(t, err)
+	entries := logs.TakeAll()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+	fields := entries[0].ContextMap()
+	assert.Contains(t, fields["sql"], "name = ?")
+	assert.Equal(t, int64(0), fields["rows"])
+	assert.Contains(t, fields, "latency")
+	assert.Contains(t, fields["caller"], "orm/logger_test.go:")
+}
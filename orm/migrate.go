@@ -0,0 +1,456 @@
+package orm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMigrationTable       = "schema_migrations"
+	defaultMigrationLockTimeout = time.Minute
+)
+
+var (
+	ErrMigrationExists       = errors.New("migration already exist")
+	ErrMigrationIrreversible = errors.New("migration has no down")
+	ErrMigrationLocked       = errors.New("migration is locked by another process")
+	ErrInvalidMigrationFile  = errors.New("invalid migration file name")
+)
+
+// migrationFileRe 迁移文件命名：{version}_{name}.up.sql / {version}_{name}.down.sql
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration 一个版本的迁移，SQL和Go函数二选一，同时设置时先执行SQL再执行函数
+type Migration struct {
+	Version uint64
+	Name    string
+	UpSQL   string
+	DownSQL string
+	Up      func(ctx context.Context, tx *gorm.DB) error
+	Down    func(ctx context.Context, tx *gorm.DB) error
+	// NoTx 不在事务中执行，用于无法在事务中执行的语句，例如 CREATE INDEX CONCURRENTLY
+	NoTx bool
+}
+
+func (m *Migration) checksum() string {
+	if m.UpSQL == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.UpSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) reversible() bool {
+	return m.DownSQL != "" || m.Down != nil
+}
+
+// MigrationStatus 迁移状态
+type MigrationStatus struct {
+	Version   uint64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // 已执行的SQL在执行后被修改过
+	Missing   bool // 数据库中有执行记录，但是代码中已经没有这个迁移
+}
+
+type migrationRecord struct {
+	Version   uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	Checksum  string `gorm:"size:64"`
+	AppliedAt time.Time
+}
+
+type MigratorOpts struct {
+	Table            string        // 迁移记录表，默认 schema_migrations
+	LockTimeout      time.Duration // 等待迁移锁的最长时间，默认1分钟
+	LockStaleTimeout time.Duration // sqlite锁表中的锁超过这个时间没有刷新后失效，默认10分钟
+	DryRun           bool          // 只输出将要执行的迁移，不修改数据库
+	Output           io.Writer     // DryRun时输出将要执行的SQL
+}
+
+type MigratorOption func(o *MigratorOpts)
+
+// WithMigrationTable : 设置迁移记录表名
+func WithMigrationTable(table string) MigratorOption {
+	return func(o *MigratorOpts) {
+		o.Table = table
+	}
+}
+
+// WithMigrationLockTimeout : 设置等待迁移锁的最长时间
+func WithMigrationLockTimeout(timeout time.Duration) MigratorOption {
+	return func(o *MigratorOpts) {
+		o.LockTimeout = timeout
+	}
+}
+
+// WithMigrationLockStaleTimeout : 设置sqlite锁表中的锁失效的时间，持有锁期间每1/3的时间刷新一次，用于清理进程崩溃后留下的锁
+func WithMigrationLockStaleTimeout(timeout time.Duration) MigratorOption {
+	return func(o *MigratorOpts) {
+		o.LockStaleTimeout = timeout
+	}
+}
+
+// WithDryRun : 只输出将要执行的迁移，不修改数据库，w不为空时输出SQL
+func WithDryRun(w io.Writer) MigratorOption {
+	return func(o *MigratorOpts) {
+		o.DryRun = true
+		o.Output = w
+	}
+}
+
+// Migrator 版本化的数据库迁移
+// 支持mysql、postgres、sqlserver、sqlite，执行期间通过数据库锁防止多个进程同时迁移
+type Migrator struct {
+	db         *gorm.DB
+	opts       *MigratorOpts
+	migrations []*Migration
+}
+
+func NewMigrator(db *gorm.DB, options ...MigratorOption) *Migrator {
+	opts := &MigratorOpts{
+		Table:            defaultMigrationTable,
+		LockTimeout:      defaultMigrationLockTimeout,
+		LockStaleTimeout: defaultLockStaleTimeout,
+	}
+	for _, op := range options {
+		op(opts)
+	}
+	return &Migrator{db: db, opts: opts}
+}
+
+// Register 注册Go函数或者SQL迁移
+func (m *Migrator) Register(migrations ...*Migration) error {
+	for _, migration := range migrations {
+		if m.find(migration.Version) != nil {
+			return fmt.Errorf("%w: %d", ErrMigrationExists, migration.Version)
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	return nil
+}
+
+// LoadFS 从fsys的dir目录加载SQL迁移文件，通常配合embed.FS使用
+// 文件名格式：0001_create_users.up.sql 和 0001_create_users.down.sql
+func (m *Migrator) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	loaded := make(map[uint64]*Migration)
+	var versions []uint64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		matches := migrationFileRe.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return fmt.Errorf("%w: %s", ErrInvalidMigrationFile, entry.Name())
+		}
+		version, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidMigrationFile, entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		migration, ok := loaded[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			loaded[version] = migration
+			versions = append(versions, version)
+		}
+		if matches[3] == "up" {
+			migration.UpSQL = string(content)
+		} else {
+			migration.DownSQL = string(content)
+		}
+	}
+	for _, version := range versions {
+		if err := m.Register(loaded[version]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Up 执行所有未执行的迁移，返回本次执行的迁移
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	return m.UpTo(ctx, 0)
+}
+
+// UpTo 执行版本号小于等于version的所有未执行的迁移，version为0表示全部
+func (m *Migrator) UpTo(ctx context.Context, version uint64) (applied []*Migration, err error) {
+	err = m.withLock(ctx, func() error {
+		records, err := m.records(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if version > 0 && migration.Version > version {
+				break
+			}
+			if _, ok := records[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, migration, true); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down 回滚最近执行的steps个迁移，返回本次回滚的迁移
+func (m *Migrator) Down(ctx context.Context, steps int) (rolledBack []*Migration, err error) {
+	err = m.withLock(ctx, func() error {
+		records, err := m.records(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := records[migration.Version]; !ok {
+				continue
+			}
+			if !migration.reversible() {
+				return fmt.Errorf("%w: %d_%s", ErrMigrationIrreversible, migration.Version, migration.Name)
+			}
+			if err := m.apply(ctx, migration, false); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status 返回所有迁移的执行状态，按版本号排序
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []*MigrationStatus
+	for _, migration := range m.migrations {
+		status := &MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := records[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			status.Modified = record.Checksum != migration.checksum()
+			delete(records, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range records {
+		statuses = append(statuses, &MigrationStatus{
+			Version:   record.Version,
+			Name:      record.Name,
+			Applied:   true,
+			AppliedAt: record.AppliedAt,
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+func (m *Migrator) find(version uint64) *Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) table(ctx context.Context) *gorm.DB {
+	return m.db.WithContext(ctx).Table(m.opts.Table)
+}
+
+func (m *Migrator) records(ctx context.Context) (map[uint64]*migrationRecord, error) {
+	records := make(map[uint64]*migrationRecord)
+	if !m.db.Migrator().HasTable(m.opts.Table) {
+		return records, nil
+	}
+	var list []*migrationRecord
+	if err := m.table(ctx).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range list {
+		records[record.Version] = record
+	}
+	return records, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration *Migration, up bool) error {
+	sql, fn := migration.DownSQL, migration.Down
+	if up {
+		sql, fn = migration.UpSQL, migration.Up
+	}
+	if m.opts.DryRun {
+		if m.opts.Output != nil {
+			direction := "down"
+			if up {
+				direction = "up"
+			}
+			_, err := fmt.Fprintf(m.opts.Output, "-- %d_%s (%s)\n%s\n", migration.Version, migration.Name, direction, sql)
+			return err
+		}
+		return nil
+	}
+	run := func(tx *gorm.DB) error {
+		for _, stmt := range splitStatements(sql, m.db.Dialector.Name()) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		if fn != nil {
+			if err := fn(ctx, tx); err != nil {
+				return err
+			}
+		}
+		if up {
+			return tx.Table(m.opts.Table).Create(&migrationRecord{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Checksum:  migration.checksum(),
+				AppliedAt: time.Now(),
+			}).Error
+		}
+		return tx.Table(m.opts.Table).Where("version = ?", migration.Version).Delete(&migrationRecord{}).Error
+	}
+	if migration.NoTx {
+		return run(m.db.WithContext(ctx))
+	}
+	return m.db.WithContext(ctx).Transaction(run)
+}
+
+// splitStatements 拆分多条SQL语句，prepared statement不支持一次执行多条语句
+// sqlserver按照单独一行的GO拆分，其他数据库按照引号和注释之外的分号拆分
+// postgres的$$、$tag$包裹的函数体中的分号不拆分；mysql支持#注释和引号中的反斜杠转义
+func splitStatements(sql, dialect string) []string {
+	var stmts []string
+	add := func(stmt string) {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	if dialect == dialectSQLServer {
+		var batch strings.Builder
+		for _, line := range strings.Split(sql, "\n") {
+			if strings.EqualFold(strings.TrimSpace(line), "GO") {
+				add(batch.String())
+				batch.Reset()
+				continue
+			}
+			batch.WriteString(line)
+			batch.WriteString("\n")
+		}
+		add(batch.String())
+		return stmts
+	}
+	var current strings.Builder
+	var quote rune
+	var dollarTag string
+	lineComment, blockComment := false, false
+	runes := []rune(sql)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		var next rune
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case lineComment:
+			if r == '\n' {
+				lineComment = false
+				current.WriteRune(r)
+			}
+			continue
+		case blockComment:
+			if r == '*' && next == '/' {
+				blockComment = false
+				current.WriteRune(r)
+				r = next
+				i++
+			}
+		case dollarTag != "":
+			if tag := []rune(dollarTag); r == '$' && i+len(tag) <= len(runes) && string(runes[i:i+len(tag)]) == dollarTag {
+				current.WriteString(dollarTag)
+				i += len(tag) - 1
+				dollarTag = ""
+				continue
+			}
+		case quote != 0:
+			if r == '\\' && dialect == dialectMySQL && quote != '`' && i+1 < len(runes) {
+				current.WriteRune(r)
+				r = next
+				i++
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '$' && dialect == dialectPostgres:
+			if tag := dollarQuoteTag(runes[i:]); tag != "" {
+				dollarTag = tag
+				current.WriteString(tag)
+				i += len([]rune(tag)) - 1
+				continue
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '-' && next == '-', r == '#' && dialect == dialectMySQL:
+			lineComment = true
+			continue
+		case r == '/' && next == '*':
+			blockComment = true
+		case r == ';':
+			add(current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	add(current.String())
+	return stmts
+}
+
+// dollarQuoteTag 返回以runes开头的postgres dollar quote标签，例如$$、$body$，不是标签时返回空
+// 标签不能以数字开头，避免和$1这样的参数混淆
+func dollarQuoteTag(runes []rune) string {
+	for i := 1; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '$':
+			return string(runes[:i+1])
+		case r == '_' || unicode.IsLetter(r) || (i > 1 && unicode.IsDigit(r)):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	migrationLockRetryInterval = 500 * time.Millisecond
+	// defaultLockStaleTimeout 锁表中超过这个时间的锁认为持有锁的进程已经退出
+	defaultLockStaleTimeout = 10 * time.Minute
+)
+
+type migrationLock struct {
+	ID       uint32 `gorm:"primaryKey;autoIncrement:false"`
+	LockedAt time.Time
+}
+
+// migrationLocker 数据库级别的锁
+// mysql/postgres/sqlserver使用会话级别的锁，加锁和解锁必须在同一个连接上
+// sqlite没有会话锁，使用锁表的唯一主键实现，持有锁期间定时刷新LockedAt，进程崩溃后留下的锁超过staleTimeout后失效
+type migrationLocker interface {
+	tryLock(ctx context.Context) (bool, error)
+	unlock(ctx context.Context) error
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func() error) (err error) {
+	if m.opts.DryRun {
+		return fn()
+	}
+	if err := ensureLockTable(ctx, m.db, m.opts.Table+"_lock"); err != nil {
+		return err
+	}
+	locker, closer, err := newLocker(ctx, m.db, m.opts.Table+"_lock", m.opts.LockStaleTimeout)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	deadline := time.Now().Add(m.opts.LockTimeout)
+	for {
+		locked, err := locker.tryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			return ErrMigrationLocked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(migrationLockRetryInterval):
+		}
+	}
+	defer func() {
+		// 迁移过程中ctx可能已经取消，解锁使用新的ctx
+		if unlockErr := locker.unlock(context.Background()); err == nil {
+			err = unlockErr
+		}
+	}()
+	// 持有锁之后再创建迁移记录表，避免多个实例同时创建
+	if err := m.db.WithContext(ctx).Table(m.opts.Table).AutoMigrate(&migrationRecord{}); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// newLocker 创建名称为name的数据库锁，返回的closer用于释放锁占用的连接
+// sqlite需要先通过ensureLockTable创建锁表
+// staleTimeout只对sqlite的锁表生效，会话锁在连接断开后由数据库自动释放
+func newLocker(ctx context.Context, db *gorm.DB, name string, staleTimeout time.Duration) (migrationLocker, func(), error) {
+	dialect := db.Dialector.Name()
+	if dialect == dialectSQLite {
+		return &tableLocker{db: db.Table(name), staleTimeout: staleTimeout}, func() {}, nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	closer := func() { _ = conn.Close() }
+	switch dialect {
+	case dialectMySQL:
+		return &mysqlLocker{conn: conn, name: name}, closer, nil
+	case dialectPostgres:
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(name))
+		return &postgresLocker{conn: conn, key: int64(h.Sum64())}, closer, nil
+	case dialectSQLServer:
+		return &sqlServerLocker{conn: conn, name: name}, closer, nil
+	default:
+		closer()
+		return nil, nil, fmt.Errorf("database lock is not supported for %s", dialect)
+	}
+}
+
+// ensureLockTable 创建sqlite的锁表，多个进程同时创建时不会失败
+func ensureLockTable(ctx context.Context, db *gorm.DB, name string) error {
+	if db.Dialector.Name() != dialectSQLite {
+		return nil
+	}
+	return db.WithContext(ctx).Exec("CREATE TABLE IF NOT EXISTS ? (id integer PRIMARY KEY, locked_at datetime)", clause.Table{Name: name}).Error
+}
+
+type mysqlLocker struct {
+	conn *sql.Conn
+	name string
+}
+
+func (l *mysqlLocker) tryLock(ctx context.Context) (bool, error) {
+	var locked sql.NullInt64
+	if err := l.conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", l.name).Scan(&locked); err != nil {
+		return false, err
+	}
+	return locked.Valid && locked.Int64 == 1, nil
+}
+
+func (l *mysqlLocker) unlock(ctx context.Context) error {
+	_, err := l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.name)
+	return err
+}
+
+type postgresLocker struct {
+	conn *sql.Conn
+	key  int64
+}
+
+func (l *postgresLocker) tryLock(ctx context.Context) (bool, error) {
+	var locked bool
+	err := l.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked)
+	return locked, err
+}
+
+func (l *postgresLocker) unlock(ctx context.Context) error {
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+	return err
+}
+
+type sqlServerLocker struct {
+	conn *sql.Conn
+	name string
+}
+
+func (l *sqlServerLocker) tryLock(ctx context.Context) (bool, error) {
+	const query = `DECLARE @result int;
+EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0;
+SELECT @result;`
+	var result int
+	if err := l.conn.QueryRowContext(ctx, query, l.name).Scan(&result); err != nil {
+		return false, err
+	}
+	return result >= 0, nil
+}
+
+func (l *sqlServerLocker) unlock(ctx context.Context) error {
+	_, err := l.conn.ExecContext(ctx, "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'", l.name)
+	return err
+}
+
+type tableLocker struct {
+	db           *gorm.DB
+	staleTimeout time.Duration
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+func (l *tableLocker) tryLock(ctx context.Context) (bool, error) {
+	now := time.Now()
+	if l.staleTimeout > 0 {
+		// 清理持有锁的进程崩溃后留下的锁
+		if err := l.db.WithContext(ctx).Where("id = ? AND locked_at < ?", 1, now.Add(-l.staleTimeout)).Delete(&migrationLock{}).Error; err != nil {
+			return false, err
+		}
+	}
+	result := l.db.WithContext(ctx).Create(&migrationLock{ID: 1, LockedAt: now})
+	if result.Error != nil {
+		// 主键冲突说明已经被其他进程锁定
+		var count int64
+		if err := l.db.WithContext(ctx).Where("id = ?", 1).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return false, nil
+		}
+		return false, result.Error
+	}
+	if l.staleTimeout > 0 {
+		l.stop, l.done = make(chan struct{}), make(chan struct{})
+		go l.refresh(l.stop, l.done)
+	}
+	return true, nil
+}
+
+// refresh 持有锁期间定时刷新LockedAt，避免执行时间超过staleTimeout时锁被其他进程清理
+func (l *tableLocker) refresh(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(l.staleTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_ = l.db.Where("id = ?", 1).Update("locked_at", time.Now()).Error
+		}
+	}
+}
+
+func (l *tableLocker) unlock(ctx context.Context) error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop, l.done = nil, nil
+	}
+	return l.db.WithContext(ctx).Where("id = ?", 1).Delete(&migrationLock{}).Error
+}
@@ -0,0 +1,130 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMigrator(t *testing.T) {
+	db := New(newSQLiteConfig(t, "migrate.db"))
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"migrations/0001_create_users.up.sql": {Data: []byte(`
+-- users; with comment
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL DEFAULT 'a;b');
+CREATE INDEX idx_users_name ON users (name);`)},
+		"migrations/0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+	}
+	newMigrator := func(options ...MigratorOption) *Migrator {
+		m := NewMigrator(db, options...)
+		assert.NoError(t, m.LoadFS(fsys, "migrations"))
+		assert.NoError(t, m.Register(&Migration{
+			Version: 3,
+			Name:    "seed_users",
+			Up: func(ctx context.Context, tx *gorm.DB) error {
+				return tx.Exec("INSERT INTO users (name, email) VALUES (?, ?)", "admin", "admin@example.com").Error
+			},
+			Down: func(ctx context.Context, tx *gorm.DB) error {
+				return tx.Exec("DELETE FROM users").Error
+			},
+		}))
+		return m
+	}
+
+	var out bytes.Buffer
+	planned, err := newMigrator(WithDryRun(&out)).Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, planned, 3)
+	assert.Contains(t, out.String(), "1_create_users (up)")
+	assert.False(t, db.Migrator().HasTable("users"))
+
+	m := newMigrator()
+	applied, err := m.UpTo(ctx, 2)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 2)
+	applied, err = m.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	var count int64
+	assert.NoError(t, db.Table("users").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	statuses, err := m.Status(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 3)
+	for _, status := range statuses {
+		assert.True(t, status.Applied)
+		assert.False(t, status.Modified)
+	}
+
+	rolledBack, err := m.Down(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, rolledBack, 1)
+	_, err = m.Down(ctx, 1)
+	assert.ErrorIs(t, err, ErrMigrationIrreversible)
+
+	locker := &tableLocker{db: db.Table(defaultMigrationTable + "_lock")}
+	locked, err := locker.tryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	_, err = newMigrator(WithMigrationLockTimeout(0)).Up(ctx)
+	assert.ErrorIs(t, err, ErrMigrationLocked)
+
+	// 超时的锁认为持有锁的进程已经退出
+	assert.NoError(t, db.Table(defaultMigrationTable+"_lock").Where("id = ?", 1).
+		Update("locked_at", time.Now().Add(-time.Hour)).Error)
+	_, err = newMigrator(WithMigrationLockTimeout(0), WithMigrationLockStaleTimeout(time.Minute)).Up(ctx)
+	assert.NoError(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `CREATE FUNCTION f() RETURNS trigger AS $$
+BEGIN
+  NEW.name := 'a;b'; RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE FUNCTION g() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+SELECT $1;`
+	stmts := splitStatements(sql, dialectPostgres)
+	assert.Len(t, stmts, 3)
+	assert.Contains(t, stmts[0], "RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql")
+	assert.Equal(t, "CREATE FUNCTION g() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql", stmts[1])
+	assert.Equal(t, "SELECT $1", stmts[2])
+
+	stmts = splitStatements("# comment; here\nINSERT INTO t VALUES ('it\\'s;', \"a\\\";b\");\nSELECT 1;", dialectMySQL)
+	assert.Equal(t, []string{"INSERT INTO t VALUES ('it\\'s;', \"a\\\";b\")", "SELECT 1"}, stmts)
+}
+
+func TestTableLockerRefresh(t *testing.T) {
+	db := New(newSQLiteConfig(t, "lock_refresh.db"))
+	ctx := context.Background()
+	assert.NoError(t, ensureLockTable(ctx, db, "refresh_lock"))
+	newLock := func() migrationLocker {
+		locker, closer, err := newLocker(ctx, db, "refresh_lock", 60*time.Millisecond)
+		assert.NoError(t, err)
+		t.Cleanup(closer)
+		return locker
+	}
+	first := newLock()
+	locked, err := first.tryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	// 持有锁期间刷新LockedAt，超过staleTimeout后锁仍然有效
+	time.Sleep(150 * time.Millisecond)
+	second := newLock()
+	locked, err = second.tryLock(ctx)
+	assert.NoError(t, err)
+	assert.False(t, locked)
+	assert.NoError(t, first.unlock(ctx))
+	locked, err = second.tryLock(ctx)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	assert.NoError(t, second.unlock(ctx))
+}
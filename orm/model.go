@@ -0,0 +1,23 @@
+package orm
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BaseModel 通用字段，包括审计字段和软删除
+// created_by/updated_by 由AuditPlugin根据ctx中的操作人自动填充
+type BaseModel struct {
+	ID        uint64         `gorm:"primaryKey"`
+	CreatedAt time.Time      `gorm:"column:created_at"`
+	UpdatedAt time.Time      `gorm:"column:updated_at"`
+	CreatedBy string         `gorm:"column:created_by;size:64"`
+	UpdatedBy string         `gorm:"column:updated_by;size:64"`
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index"`
+}
+
+// TenantModel 多租户字段，tenant_id 由TenantPlugin根据ctx中的租户自动填充和过滤
+type TenantModel struct {
+	TenantID string `gorm:"column:tenant_id;size:64;index"`
+}
@@ -0,0 +1,382 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/byteflowing/go-common/logx"
+	"github.com/byteflowing/go-common/redis"
+	"github.com/byteflowing/go-common/signalx"
+)
+
+const (
+	defaultOutboxTable           = "orm_outbox"
+	defaultOutboxPollInterval    = time.Second
+	defaultOutboxBatchSize       = 100
+	defaultOutboxMaxAttempts     = 10
+	defaultOutboxInitialBackoff  = time.Second
+	defaultOutboxMaxBackoff      = 10 * time.Minute
+	defaultOutboxRetention       = 7 * 24 * time.Hour
+	defaultOutboxCleanupInterval = time.Hour
+	maxOutboxErrorLength         = 1024
+)
+
+// ErrOutboxNoTx Add需要在事务的ctx中调用
+var ErrOutboxNoTx = errors.New("orm: outbox add requires a transaction")
+
+var _ signalx.SignalHandler = (*Outbox)(nil)
+
+// OutboxStatus 消息状态
+type OutboxStatus int8
+
+const (
+	OutboxPending   OutboxStatus = iota // 等待投递
+	OutboxDelivered                     // 已投递
+	OutboxDead                          // 超过最大重试次数，不再投递，同一个key后面的消息会继续投递
+)
+
+// OutboxMessage outbox表中的消息
+type OutboxMessage struct {
+	ID            uint64 `gorm:"primaryKey"`
+	Topic         string `gorm:"size:128;not null"`
+	AggregateKey  string `gorm:"size:128;index"` // 相同key的消息按照写入顺序投递，为空时不保证顺序
+	Payload       []byte
+	Status        OutboxStatus `gorm:"not null;default:0;index"`
+	Attempts      int          `gorm:"not null;default:0"`
+	NextAttemptAt time.Time
+	LastError     string `gorm:"size:1024"`
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time `gorm:"index"`
+}
+
+// Publisher 消息投递，返回nil表示投递成功
+// 进程在投递成功和标记已投递之间退出时消息会被重复投递，消费方需要根据ID幂等处理
+type Publisher interface {
+	Publish(ctx context.Context, msg *OutboxMessage) error
+}
+
+// PublisherFunc 函数形式的Publisher，例如通过HTTP回调投递
+type PublisherFunc func(ctx context.Context, msg *OutboxMessage) error
+
+func (f PublisherFunc) Publish(ctx context.Context, msg *OutboxMessage) error {
+	return f(ctx, msg)
+}
+
+type redisStreamPublisher struct {
+	r      *redis.Redis
+	prefix string
+}
+
+// NewRedisStreamPublisher 投递到redis stream，stream名称为 prefix+topic
+// 字段包括id、key和payload
+func NewRedisStreamPublisher(r *redis.Redis, prefix string) Publisher {
+	return &redisStreamPublisher{r: r, prefix: prefix}
+}
+
+func (p *redisStreamPublisher) Publish(ctx context.Context, msg *OutboxMessage) error {
+	return p.r.XAdd(ctx, &goredis.XAddArgs{
+		Stream: p.prefix + msg.Topic,
+		Values: map[string]any{
+			"id":      msg.ID,
+			"key":     msg.AggregateKey,
+			"payload": msg.Payload,
+		},
+	}).Err()
+}
+
+type OutboxOpts struct {
+	Table           string        // outbox表名，默认orm_outbox
+	PollInterval    time.Duration // 轮询间隔，默认1s
+	BatchSize       int           // 每次轮询读取的消息数量，默认100
+	MaxAttempts     int           // 最大投递次数，超过后标记为OutboxDead，默认10
+	InitialBackoff  time.Duration // 第一次重试的等待时间，之后每次翻倍，默认1s
+	MaxBackoff      time.Duration // 最大等待时间，默认10m
+	Retention       time.Duration // 已投递消息的保留时间，默认7天，小于0时不清理
+	CleanupInterval time.Duration // 清理间隔，默认1h
+}
+
+type OutboxOption func(o *OutboxOpts)
+
+// WithOutboxTable : 设置outbox表名
+func WithOutboxTable(table string) OutboxOption {
+	return func(o *OutboxOpts) {
+		o.Table = table
+	}
+}
+
+// WithOutboxPolling : 设置轮询间隔和每次读取的消息数量
+func WithOutboxPolling(interval time.Duration, batchSize int) OutboxOption {
+	return func(o *OutboxOpts) {
+		if interval > 0 {
+			o.PollInterval = interval
+		}
+		if batchSize > 0 {
+			o.BatchSize = batchSize
+		}
+	}
+}
+
+// WithOutboxRetry : 设置最大投递次数和退避时间
+func WithOutboxRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration) OutboxOption {
+	return func(o *OutboxOpts) {
+		if maxAttempts > 0 {
+			o.MaxAttempts = maxAttempts
+		}
+		if initialBackoff > 0 {
+			o.InitialBackoff = initialBackoff
+		}
+		if maxBackoff > 0 {
+			o.MaxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithOutboxRetention : 设置已投递消息的保留时间和清理间隔，retention小于0时不清理
+func WithOutboxRetention(retention, cleanupInterval time.Duration) OutboxOption {
+	return func(o *OutboxOpts) {
+		o.Retention = retention
+		if cleanupInterval > 0 {
+			o.CleanupInterval = cleanupInterval
+		}
+	}
+}
+
+// Outbox 事务型outbox
+// Add在业务事务中写入消息，relay在后台轮询未投递的消息并通过Publisher投递，投递语义为至少一次
+// 多个实例同时运行时通过数据库锁保证同一时刻只有一个实例在投递
+// 实现了signalx.SignalHandler，可以直接注册到SignalListener
+type Outbox struct {
+	db        *gorm.DB
+	publisher Publisher
+	opts      *OutboxOpts
+
+	mu          sync.Mutex
+	cancel      context.CancelFunc
+	done        chan struct{}
+	lastCleanup atomic.Int64 // 上次清理的时间，UnixNano
+	lockReady   atomic.Bool  // sqlite的锁表已经创建
+}
+
+func NewOutbox(db *gorm.DB, publisher Publisher, options ...OutboxOption) *Outbox {
+	opts := &OutboxOpts{
+		Table:           defaultOutboxTable,
+		PollInterval:    defaultOutboxPollInterval,
+		BatchSize:       defaultOutboxBatchSize,
+		MaxAttempts:     defaultOutboxMaxAttempts,
+		InitialBackoff:  defaultOutboxInitialBackoff,
+		MaxBackoff:      defaultOutboxMaxBackoff,
+		Retention:       defaultOutboxRetention,
+		CleanupInterval: defaultOutboxCleanupInterval,
+	}
+	for _, op := range options {
+		op(opts)
+	}
+	return &Outbox{db: db, publisher: publisher, opts: opts}
+}
+
+// Migrate 创建outbox表
+func (o *Outbox) Migrate(ctx context.Context) error {
+	if err := o.db.WithContext(ctx).Table(o.opts.Table).AutoMigrate(&OutboxMessage{}); err != nil {
+		return err
+	}
+	return o.ensureLockTable(ctx)
+}
+
+// ensureLockTable 只在第一次投递时创建sqlite的锁表，不在每次轮询时执行DDL
+func (o *Outbox) ensureLockTable(ctx context.Context) error {
+	if o.lockReady.Load() {
+		return nil
+	}
+	if err := ensureLockTable(ctx, o.db, o.opts.Table+"_lock"); err != nil {
+		return err
+	}
+	o.lockReady.Store(true)
+	return nil
+}
+
+// Add 写入消息，需要在业务事务的ctx中调用（参考WithTx），保证消息和业务数据一起提交或回滚
+// ctx中没有事务时返回ErrOutboxNoTx
+func (o *Outbox) Add(ctx context.Context, topic, aggregateKey string, payload []byte) error {
+	if !InTx(ctx, o.db) {
+		return ErrOutboxNoTx
+	}
+	msg := &OutboxMessage{
+		Topic:         topic,
+		AggregateKey:  aggregateKey,
+		Payload:       payload,
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	return FromCtx(ctx, o.db).Table(o.opts.Table).Create(msg).Error
+}
+
+// Start 在新的goroutine中运行relay（非阻塞）
+func (o *Outbox) Start() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.done = make(chan struct{})
+	go o.run(ctx, o.done)
+}
+
+// Stop 停止relay，等待正在进行的投递完成
+func (o *Outbox) Stop() {
+	o.mu.Lock()
+	cancel, done := o.cancel, o.done
+	o.cancel, o.done = nil, nil
+	o.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (o *Outbox) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(o.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := o.Relay(ctx); err != nil && ctx.Err() == nil {
+			logx.CtxError(ctx, "outbox relay failed", zap.String("table", o.opts.Table), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Relay 执行一次投递和清理，返回成功投递的消息数量
+// 其他实例正在投递时直接返回
+func (o *Outbox) Relay(ctx context.Context) (delivered int, err error) {
+	if err := o.ensureLockTable(ctx); err != nil {
+		return 0, err
+	}
+	locker, closer, err := newLocker(ctx, o.db, o.opts.Table+"_lock", defaultLockStaleTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer closer()
+	locked, err := locker.tryLock(ctx)
+	if err != nil || !locked {
+		return 0, err
+	}
+	defer func() {
+		if unlockErr := locker.unlock(context.Background()); err == nil {
+			err = unlockErr
+		}
+	}()
+	delivered, err = o.deliver(ctx)
+	if err != nil {
+		return delivered, err
+	}
+	return delivered, o.cleanup(ctx)
+}
+
+// deliver 读取到期的消息并投递
+// 同一个key前面有未到期的消息时，后面的消息在SQL中直接排除，避免这些消息占满BatchSize导致其他key的消息无法投递
+func (o *Outbox) deliver(ctx context.Context) (int, error) {
+	now := time.Now()
+	waiting := o.db.Table(o.opts.Table+" AS p").Select("1").
+		Where("p.aggregate_key = m.aggregate_key AND p.status = ? AND p.id < m.id AND p.next_attempt_at > ?", OutboxPending, now)
+	var msgs []*OutboxMessage
+	if err := o.db.WithContext(ctx).Table(o.opts.Table+" AS m").
+		Where("m.status = ? AND m.next_attempt_at <= ?", OutboxPending, now).
+		Where("m.aggregate_key = '' OR NOT EXISTS (?)", waiting).
+		Order(clause.OrderByColumn{Column: clause.Column{Table: "m", Name: "id"}}).
+		Limit(o.opts.BatchSize).
+		Find(&msgs).Error; err != nil {
+		return 0, err
+	}
+	// 同一个key前面的消息在本次投递失败时，后面的消息需要等待
+	blocked := make(map[string]bool)
+	delivered := 0
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+		if msg.AggregateKey != "" && blocked[msg.AggregateKey] {
+			continue
+		}
+		if err := o.publisher.Publish(ctx, msg); err != nil {
+			blocked[msg.AggregateKey] = msg.AggregateKey != ""
+			if err := o.markFailed(ctx, msg, err); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		deliveredAt := time.Now()
+		if err := o.db.WithContext(ctx).Table(o.opts.Table).Where("id = ?", msg.ID).
+			Updates(map[string]any{"status": OutboxDelivered, "delivered_at": deliveredAt, "attempts": msg.Attempts + 1}).
+			Error; err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+func (o *Outbox) markFailed(ctx context.Context, msg *OutboxMessage, publishErr error) error {
+	attempts := msg.Attempts + 1
+	status := OutboxPending
+	if attempts >= o.opts.MaxAttempts {
+		status = OutboxDead
+		logx.CtxError(ctx, "outbox message is dead",
+			zap.Uint64("id", msg.ID), zap.String("topic", msg.Topic), zap.Error(publishErr))
+	}
+	lastError := publishErr.Error()
+	if len(lastError) > maxOutboxErrorLength {
+		lastError = lastError[:maxOutboxErrorLength]
+	}
+	return o.db.WithContext(ctx).Table(o.opts.Table).Where("id = ?", msg.ID).Updates(map[string]any{
+		"status":          status,
+		"attempts":        attempts,
+		"next_attempt_at": time.Now().Add(o.backoff(attempts)),
+		"last_error":      lastError,
+	}).Error
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	backoff := o.opts.InitialBackoff
+	for i := 1; i < attempts && backoff < o.opts.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, o.opts.MaxBackoff)
+}
+
+func (o *Outbox) cleanup(ctx context.Context) error {
+	if o.opts.Retention < 0 || time.Since(time.Unix(0, o.lastCleanup.Load())) < o.opts.CleanupInterval {
+		return nil
+	}
+	err := o.db.WithContext(ctx).Table(o.opts.Table).
+		Where("status = ? AND delivered_at < ?", OutboxDelivered, time.Now().Add(-o.opts.Retention)).
+		Delete(&OutboxMessage{}).Error
+	if err == nil {
+		o.lastCleanup.Store(time.Now().UnixNano())
+	}
+	return err
+}
+
+// Retry 将OutboxDead状态的消息重新设置为等待投递
+func (o *Outbox) Retry(ctx context.Context, ids ...uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return o.db.WithContext(ctx).Table(o.opts.Table).
+		Where("status = ? AND id IN ?", OutboxDead, ids).
+		Updates(map[string]any{"status": OutboxPending, "attempts": 0, "next_attempt_at": time.Now()}).Error
+}
@@ -0,0 +1,122 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	db := New(newSQLiteConfig(t, "outbox.db"))
+	assert.NoError(t, db.AutoMigrate(&testUser{}))
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var published []string
+	failures := map[string]int{"a1": 1}
+	outbox := NewOutbox(db, PublisherFunc(func(ctx context.Context, msg *OutboxMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures[string(msg.Payload)] > 0 {
+			failures[string(msg.Payload)]--
+			return errors.New("publish failed")
+		}
+		published = append(published, string(msg.Payload))
+		return nil
+	}), WithOutboxRetry(3, time.Millisecond, time.Millisecond), WithOutboxRetention(0, time.Millisecond))
+	assert.NoError(t, outbox.Migrate(ctx))
+
+	// 事务回滚时消息不会写入
+	err := WithTx(ctx, db, func(ctx context.Context) error {
+		assert.NoError(t, FromCtx(ctx, db).Create(&testUser{Name: "a"}).Error)
+		assert.NoError(t, outbox.Add(ctx, "user", "a", []byte("rollback")))
+		return errors.New("rollback")
+	})
+	assert.Error(t, err)
+	assert.NoError(t, WithTx(ctx, db, func(ctx context.Context) error {
+		for _, payload := range []string{"a1", "b1", "a2"} {
+			if err := outbox.Add(ctx, "user", payload[:1], []byte(payload)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	// a1投递失败，a2需要等待a1
+	delivered, err := outbox.Relay(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, []string{"b1"}, published)
+
+	time.Sleep(5 * time.Millisecond)
+	outbox.Start()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published) == 3
+	}, 3*time.Second, 10*time.Millisecond)
+	outbox.Stop()
+	assert.Equal(t, []string{"b1", "a1", "a2"}, published)
+
+	// 已投递的消息被清理
+	var count int64
+	assert.NoError(t, db.Table(defaultOutboxTable).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestOutbox_BlockedKeyDoesNotStarve(t *testing.T) {
+	db := New(newSQLiteConfig(t, "outbox_blocked.db"))
+	ctx := context.Background()
+	var published []string
+	outbox := NewOutbox(db, PublisherFunc(func(ctx context.Context, msg *OutboxMessage) error {
+		if string(msg.Payload) == "a1" {
+			return errors.New("publish failed")
+		}
+		published = append(published, string(msg.Payload))
+		return nil
+	}), WithOutboxPolling(time.Second, 2), WithOutboxRetry(3, time.Hour, time.Hour))
+	assert.NoError(t, outbox.Migrate(ctx))
+	assert.ErrorIs(t, outbox.Add(ctx, "user", "a", []byte("a0")), ErrOutboxNoTx)
+
+	assert.NoError(t, WithTx(ctx, db, func(ctx context.Context) error {
+		for _, payload := range []string{"a1", "a2", "a3", "b1"} {
+			if err := outbox.Add(ctx, "user", payload[:1], []byte(payload)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	delivered, err := outbox.Relay(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+
+	// a1等待重试，a2和a3不会占用BatchSize
+	delivered, err = outbox.Relay(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, []string{"b1"}, published)
+}
+
+func TestOutbox_ConcurrentRelay(t *testing.T) {
+	db := New(newSQLiteConfig(t, "outbox_concurrent.db"))
+	ctx := context.Background()
+	outbox := NewOutbox(db, PublisherFunc(func(ctx context.Context, msg *OutboxMessage) error {
+		return nil
+	}), WithOutboxRetention(0, time.Nanosecond))
+	assert.NoError(t, outbox.Migrate(ctx))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, _ = outbox.Relay(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,224 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const defaultBatchSize = 500
+
+var ErrNoPrimaryKey = errors.New("orm: model has no primary key")
+
+// Repository 通用的CRUD封装
+// 所有方法都会通过FromCtx使用ctx中的事务，可以直接在WithTx中调用
+type Repository[T any] struct {
+	db     *gorm.DB
+	schema *schema.Schema
+}
+
+// NewRepository 创建Repository，T无法被gorm解析时panic
+func NewRepository[T any](db *gorm.DB) *Repository[T] {
+	stmt, err := parseStatement[T](db)
+	if err != nil {
+		panic(err)
+	}
+	return &Repository[T]{db: db, schema: stmt.Schema}
+}
+
+// DB 返回当前ctx对应的db，已经设置好Model
+func (r *Repository[T]) DB(ctx context.Context) *gorm.DB {
+	return FromCtx(ctx, r.db).Model(new(T))
+}
+
+// Where 使用filter构建查询，filter可以是Filter、struct或者map，参考ParseFilter
+func (r *Repository[T]) Where(ctx context.Context, filter any) (*gorm.DB, error) {
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Validate(r.schema); err != nil {
+		return nil, err
+	}
+	return r.DB(ctx).Scopes(f.Scope), nil
+}
+
+// Get 根据主键查询，不存在时返回gorm.ErrRecordNotFound
+func (r *Repository[T]) Get(ctx context.Context, id any) (*T, error) {
+	pk, err := r.primaryKey()
+	if err != nil {
+		return nil, err
+	}
+	entity := new(T)
+	if err := r.DB(ctx).Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: pk}, Value: id}).
+		Take(entity).Error; err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// List 根据filter查询，orders为排序语句，例如 "id DESC"
+func (r *Repository[T]) List(ctx context.Context, filter any, orders ...string) ([]*T, error) {
+	tx, err := r.Where(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		tx = tx.Order(order)
+	}
+	list := []*T{}
+	if err := tx.Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Page 根据filter分页查询
+func (r *Repository[T]) Page(ctx context.Context, filter any, page, pageSize uint32, options ...PaginateOption) (*PageResult[T], error) {
+	tx, err := r.Where(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return Paginate[T](tx, page, pageSize, options...)
+}
+
+// Count 根据filter统计数量
+func (r *Repository[T]) Count(ctx context.Context, filter any) (int64, error) {
+	tx, err := r.Where(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = tx.Count(&count).Error
+	return count, err
+}
+
+// Exists 是否存在满足filter的记录
+func (r *Repository[T]) Exists(ctx context.Context, filter any) (bool, error) {
+	tx, err := r.Where(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	var exists []int
+	if err := tx.Select("1").Limit(1).Find(&exists).Error; err != nil {
+		return false, err
+	}
+	return len(exists) > 0, nil
+}
+
+func (r *Repository[T]) Create(ctx context.Context, entity *T) error {
+	return r.DB(ctx).Create(entity).Error
+}
+
+// BatchCreate 分批创建，batchSize<=0时使用默认值500
+// 不在事务中时会自动开启事务，保证所有批次要么全部成功要么全部失败
+func (r *Repository[T]) BatchCreate(ctx context.Context, entities []*T, batchSize int) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return WithTx(ctx, r.db, func(ctx context.Context) error {
+		return r.DB(ctx).CreateInBatches(entities, batchSize).Error
+	})
+}
+
+// Update 根据主键更新，fields为需要更新的列(字段掩码)，为空时只更新非零值字段
+// 返回受影响的行数
+func (r *Repository[T]) Update(ctx context.Context, entity *T, fields ...string) (int64, error) {
+	tx := FromCtx(ctx, r.db).Model(entity)
+	if len(fields) > 0 {
+		columns, err := r.columns(fields)
+		if err != nil {
+			return 0, err
+		}
+		tx = tx.Select(columns)
+	}
+	result := tx.Updates(entity)
+	return result.RowsAffected, result.Error
+}
+
+// UpdateWhere 根据filter批量更新，filter不能为空
+func (r *Repository[T]) UpdateWhere(ctx context.Context, filter any, values map[string]any) (int64, error) {
+	tx, err := r.Where(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	result := tx.Updates(values)
+	return result.RowsAffected, result.Error
+}
+
+// Upsert 插入，冲突时更新
+// conflictColumns为冲突判断的列，为空时使用主键；updateColumns为冲突时更新的列，为空时更新所有列
+// mysql使用ON DUPLICATE KEY UPDATE（忽略conflictColumns），postgres/sqlite使用ON CONFLICT，sqlserver使用MERGE
+func (r *Repository[T]) Upsert(ctx context.Context, entities []*T, conflictColumns []string, updateColumns []string) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	onConflict := clause.OnConflict{}
+	if len(conflictColumns) > 0 {
+		columns, err := r.columns(conflictColumns)
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+		}
+	}
+	if len(updateColumns) > 0 {
+		columns, err := r.columns(updateColumns)
+		if err != nil {
+			return err
+		}
+		onConflict.DoUpdates = clause.AssignmentColumns(columns)
+	} else {
+		onConflict.UpdateAll = true
+	}
+	return r.DB(ctx).Clauses(onConflict).Create(entities).Error
+}
+
+// Delete 根据主键删除，model包含gorm.DeletedAt时为软删除
+func (r *Repository[T]) Delete(ctx context.Context, id any) (int64, error) {
+	pk, err := r.primaryKey()
+	if err != nil {
+		return 0, err
+	}
+	result := r.DB(ctx).Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: pk}, Value: id}).
+		Delete(new(T))
+	return result.RowsAffected, result.Error
+}
+
+// DeleteWhere 根据filter删除，filter不能为空
+func (r *Repository[T]) DeleteWhere(ctx context.Context, filter any) (int64, error) {
+	tx, err := r.Where(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	result := tx.Delete(new(T))
+	return result.RowsAffected, result.Error
+}
+
+func (r *Repository[T]) primaryKey() (string, error) {
+	if r.schema.PrioritizedPrimaryField == nil {
+		return "", ErrNoPrimaryKey
+	}
+	return r.schema.PrioritizedPrimaryField.DBName, nil
+}
+
+// columns 将字段名或者列名转换为列名，不存在时返回错误
+func (r *Repository[T]) columns(fields []string) ([]string, error) {
+	columns := make([]string, 0, len(fields))
+	for _, name := range fields {
+		field := r.schema.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownFilterColumn, name)
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns, nil
+}
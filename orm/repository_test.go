@@ -0,0 +1,94 @@
+package orm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type testProduct struct {
+	ID    uint64 `gorm:"primaryKey"`
+	SKU   string `gorm:"uniqueIndex;size:32"`
+	Name  string
+	Price int
+}
+
+type testProductFilter struct {
+	Name     string   `filter:"name,like"`
+	SKUs     []string `filter:"sku"`
+	MinPrice *int     `filter:"price,gte"`
+	MaxPrice *int     `filter:"price,lte"`
+}
+
+func TestRepository(t *testing.T) {
+	db := New(newSQLiteConfig(t, "repo.db"))
+	assert.NoError(t, db.AutoMigrate(&testProduct{}))
+	repo := NewRepository[testProduct](db)
+	ctx := context.Background()
+
+	products := []*testProduct{
+		{SKU: "a", Name: "apple", Price: 5},
+		{SKU: "b", Name: "banana", Price: 3},
+		{SKU: "c", Name: "cherry", Price: 10},
+	}
+	assert.NoError(t, repo.BatchCreate(ctx, products, 2))
+
+	minPrice := 4
+	list, err := repo.List(ctx, &testProductFilter{MinPrice: &minPrice}, "price DESC")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "cherry", list[0].Name)
+
+	list, err = repo.List(ctx, map[string]any{"sku": []string{"a", "b"}, "name__like": "b%"})
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	_, err = repo.List(ctx, map[string]any{"password": "x"})
+	assert.ErrorIs(t, err, ErrUnknownFilterColumn)
+	_, err = repo.List(ctx, NewFilter(Eq("name; DROP TABLE x", 1)))
+	assert.ErrorIs(t, err, ErrUnknownFilterColumn)
+
+	page, err := repo.Page(ctx, NewFilter(Range("price", 3, nil)), 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), page.Total)
+	assert.True(t, page.HasNext)
+
+	// 字段掩码只更新price
+	affected, err := repo.Update(ctx, &testProduct{ID: products[0].ID, Name: "ignored", Price: 6}, "Price")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+	got, err := repo.Get(ctx, products[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "apple", got.Name)
+	assert.Equal(t, 6, got.Price)
+
+	assert.NoError(t, repo.Upsert(ctx, []*testProduct{{SKU: "a", Name: "apricot", Price: 7}, {SKU: "d", Name: "date", Price: 1}},
+		[]string{"sku"}, []string{"price"}))
+	got, err = repo.Get(ctx, products[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "apple", got.Name)
+	assert.Equal(t, 7, got.Price)
+
+	// 事务回滚
+	err = WithTx(ctx, db, func(ctx context.Context) error {
+		if _, err := repo.Delete(ctx, products[1].ID); err != nil {
+			return err
+		}
+		return gorm.ErrInvalidTransaction
+	})
+	assert.ErrorIs(t, err, gorm.ErrInvalidTransaction)
+	exists, err := repo.Exists(ctx, NewFilter(Eq("sku", "b")))
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	_, err = repo.DeleteWhere(ctx, nil)
+	assert.ErrorIs(t, err, gorm.ErrMissingWhereClause)
+	affected, err = repo.DeleteWhere(ctx, NewFilter(In("sku", []string{"b", "d"})))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+	count, err := repo.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
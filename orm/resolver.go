@@ -0,0 +1,201 @@
+package orm
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/bytedance/gopkg/lang/fastrand"
+	"gorm.io/gorm"
+
+	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
+)
+
+const (
+	resolverName       = "orm:resolver"
+	forcePrimarySetKey = "orm:force_primary"
+)
+
+type forcePrimaryCtxKey struct{}
+
+// ReplicaPolicy 从库选择策略
+type ReplicaPolicy int
+
+const (
+	ReplicaRoundRobin ReplicaPolicy = iota // 轮询
+	ReplicaWeighted                        // 按权重随机
+)
+
+// ClusterConfig 主从配置
+// 写操作和事务走主库，读操作按照Policy分配到从库
+type ClusterConfig struct {
+	Primary  *configv1.DbConfig
+	Replicas []*ReplicaConfig
+	Policy   ReplicaPolicy
+}
+
+type ReplicaConfig struct {
+	Config *configv1.DbConfig
+	Weight uint32 // 仅在ReplicaWeighted时生效，为0时按1处理
+}
+
+// NewCluster 创建主从读写分离的db，失败时panic
+// 返回的db与New返回的一样可以直接使用，读请求会自动路由到从库
+// 需要读主库时（例如写后立即读）使用 WithPrimary(ctx) 或者 db.Scopes(ForcePrimary)
+func NewCluster(c *ClusterConfig, options ...OpenOption) *gorm.DB {
+	db, err := OpenCluster(context.Background(), c, options...)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// OpenCluster 创建主从读写分离的db，options作用于主库和所有从库
+// 失败时关闭已经打开的连接
+func OpenCluster(ctx context.Context, c *ClusterConfig, options ...OpenOption) (_ *gorm.DB, err error) {
+	db, err := Open(ctx, c.Primary, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Replicas) == 0 {
+		return db, nil
+	}
+	opened := []*gorm.DB{db}
+	defer func() {
+		if err != nil {
+			closeAll(opened)
+		}
+	}()
+	r := &resolver{policy: c.Policy}
+	for _, replica := range c.Replicas {
+		replicaDB, err := Open(ctx, replica.Config, options...)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, replicaDB)
+		weight := replica.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		r.replicas = append(r.replicas, replicaDB.ConnPool)
+		r.weights = append(r.weights, weight)
+		r.totalWeight += uint64(weight)
+	}
+	if err := db.Use(r); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func closeAll(dbs []*gorm.DB) {
+	for _, db := range dbs {
+		closeDB(db)
+	}
+}
+
+func closeDB(db *gorm.DB) {
+	if db == nil {
+		return
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+}
+
+// WithPrimary 返回强制读主库的ctx
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryCtxKey{}, true)
+}
+
+// ForcePrimary 强制本次查询读主库，用法：db.Scopes(orm.ForcePrimary).Find(&list)
+func ForcePrimary(db *gorm.DB) *gorm.DB {
+	return db.Set(forcePrimarySetKey, true)
+}
+
+type resolver struct {
+	primary     gorm.ConnPool
+	replicas    []gorm.ConnPool
+	weights     []uint32
+	totalWeight uint64
+	policy      ReplicaPolicy
+	next        atomic.Uint64
+}
+
+func (r *resolver) Name() string {
+	return resolverName
+}
+
+func (r *resolver) Initialize(db *gorm.DB) error {
+	r.primary = db.ConnPool
+	cb := db.Callback()
+	// 只有Find/First/Take/Count/Pluck等走query callback的读请求会路由到从库
+	// Row/Rows/Scan以及migrator都走row callback，保持读主库
+	if err := cb.Query().Before("gorm:query").Register(resolverName, r.switchReplica); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register(resolverName, r.switchPrimary); err != nil {
+		return err
+	}
+	if err := cb.Create().Before("gorm:begin_transaction").Register(resolverName, r.switchPrimary); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register(resolverName, r.switchPrimary); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:begin_transaction").Register(resolverName, r.switchPrimary); err != nil {
+		return err
+	}
+	return cb.Raw().Before("gorm:raw").Register(resolverName, r.switchPrimary)
+}
+
+func (r *resolver) switchReplica(db *gorm.DB) {
+	if db.Error != nil || inTransaction(db) || r.forcePrimary(db) {
+		return
+	}
+	// SELECT ... FOR UPDATE 之类的锁定读必须走主库
+	if _, ok := db.Statement.Clauses["FOR"]; ok {
+		return
+	}
+	db.Statement.ConnPool = r.pick()
+}
+
+// switchPrimary 链式调用时statement会被复用，写操作前需要切回主库
+func (r *resolver) switchPrimary(db *gorm.DB) {
+	if db.Error != nil || inTransaction(db) {
+		return
+	}
+	for _, replica := range r.replicas {
+		if db.Statement.ConnPool == replica {
+			db.Statement.ConnPool = r.primary
+			return
+		}
+	}
+}
+
+func (r *resolver) forcePrimary(db *gorm.DB) bool {
+	if force, ok := db.Get(forcePrimarySetKey); ok && force == true {
+		return true
+	}
+	ctx := db.Statement.Context
+	return ctx != nil && ctx.Value(forcePrimaryCtxKey{}) == true
+}
+
+func (r *resolver) pick() gorm.ConnPool {
+	if len(r.replicas) == 1 {
+		return r.replicas[0]
+	}
+	if r.policy == ReplicaWeighted {
+		n := uint64(fastrand.Int63n(int64(r.totalWeight)))
+		for i, weight := range r.weights {
+			if n < uint64(weight) {
+				return r.replicas[i]
+			}
+			n -= uint64(weight)
+		}
+	}
+	return r.replicas[(r.next.Add(1)-1)%uint64(len(r.replicas))]
+}
+
+func inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
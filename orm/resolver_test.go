@@ -0,0 +1,89 @@
+package orm
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	configv1 "github.com/byteflowing/proto/gen/go/config/v1"
+	enumv1 "github.com/byteflowing/proto/gen/go/enums/v1"
+)
+
+type testUser struct {
+	ID   uint64
+	Name string
+}
+
+func newSQLiteConfig(t *testing.T, name string) *configv1.DbConfig {
+	return &configv1.DbConfig{
+		DbType: enumv1.DbType_DB_TYPE_SQLITE,
+		Sqlite: &configv1.DbSQLite{DbPath: filepath.Join(t.TempDir(), name)},
+	}
+}
+
+func TestNewCluster(t *testing.T) {
+	primaryConfig := newSQLiteConfig(t, "primary.db")
+	replicaConfig := newSQLiteConfig(t, "replica.db")
+	replica := New(replicaConfig)
+	assert.NoError(t, replica.AutoMigrate(&testUser{}))
+	assert.NoError(t, replica.Create(&testUser{Name: "replica"}).Error)
+
+	db := NewCluster(&ClusterConfig{
+		Primary:  primaryConfig,
+		Replicas: []*ReplicaConfig{{Config: replicaConfig}},
+	})
+	assert.NoError(t, db.AutoMigrate(&testUser{}))
+	assert.NoError(t, db.Create(&testUser{Name: "primary"}).Error)
+
+	var user testUser
+	assert.NoError(t, db.First(&user).Error)
+	assert.Equal(t, "replica", user.Name)
+
+	user = testUser{}
+	assert.NoError(t, db.WithContext(WithPrimary(context.Background())).First(&user).Error)
+	assert.Equal(t, "primary", user.Name)
+
+	user = testUser{}
+	assert.NoError(t, db.Scopes(ForcePrimary).First(&user).Error)
+	assert.Equal(t, "primary", user.Name)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		user = testUser{}
+		return tx.First(&user).Error
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "primary", user.Name)
+}
+
+func TestDataSources(t *testing.T) {
+	ds := NewDataSources()
+	db := New(newSQLiteConfig(t, "ds.db"))
+	ds.Register("main", db)
+	assert.Equal(t, db, ds.MustGet("main"))
+	_, ok := ds.Get("other")
+	assert.False(t, ok)
+	assert.Panics(t, func() { ds.Register("main", db) })
+}
+
+func TestOpenClusterReplicaFailed(t *testing.T) {
+	ctx := context.Background()
+	badConfig := &configv1.DbConfig{
+		DbType: enumv1.DbType_DB_TYPE_SQLITE,
+		Sqlite: &configv1.DbSQLite{DbPath: filepath.Join(t.TempDir(), "missing", "replica.db")},
+	}
+	_, err := OpenCluster(ctx, &ClusterConfig{
+		Primary:  newSQLiteConfig(t, "primary.db"),
+		Replicas: []*ReplicaConfig{{Config: badConfig}},
+	})
+	assert.Error(t, err)
+
+	db, err := Open(ctx, newSQLiteConfig(t, "closed.db"))
+	assert.NoError(t, err)
+	closeAll([]*gorm.DB{db})
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	assert.Error(t, sqlDB.Ping())
+}
@@ -0,0 +1,414 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/byteflowing/go-common/idx"
+)
+
+const (
+	shardingPluginName     = "orm:sharding"
+	defaultFanOutParallel  = 8
+	shardingMonthLayout    = "200601"
+	shardingMaxMonthShards = 1200
+)
+
+var (
+	ErrMissingShardingKey = errors.New("orm: missing sharding key")
+	ErrCrossShard         = errors.New("orm: values belong to different shards")
+	ErrInvalidShardValue  = errors.New("orm: invalid sharding value")
+)
+
+// ShardingStrategy 分表策略
+type ShardingStrategy interface {
+	// Suffix 根据分表键的值返回分表后缀，例如 _05
+	Suffix(value any) (string, error)
+	// Suffixes 返回所有分表后缀，用于跨分表查询
+	Suffixes() []string
+}
+
+type hashStrategy struct {
+	shards int
+	width  int
+}
+
+// HashStrategy 按照分表键取模分表，整数直接取模（负数取绝对值），其他字符串使用fnv哈希后取模
+// 后缀按照分表数量补零，例如64张表为 _00 ~ _63
+func HashStrategy(shards int) ShardingStrategy {
+	if shards <= 0 {
+		panic("orm: shards must be positive")
+	}
+	return &hashStrategy{shards: shards, width: len(strconv.Itoa(shards - 1))}
+}
+
+func (s *hashStrategy) Suffix(value any) (string, error) {
+	var n uint64
+	if u, ok := toUint64(value); ok {
+		n = u
+	} else if i, ok := toInt64(value); ok {
+		if i < 0 {
+			i = -i
+		}
+		n = uint64(i)
+	} else if str, ok := value.(string); ok {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(str))
+		n = h.Sum64()
+	} else {
+		return "", fmt.Errorf("%w: %T", ErrInvalidShardValue, value)
+	}
+	return s.format(int(n % uint64(s.shards))), nil
+}
+
+func (s *hashStrategy) Suffixes() []string {
+	suffixes := make([]string, s.shards)
+	for i := range suffixes {
+		suffixes[i] = s.format(i)
+	}
+	return suffixes
+}
+
+func (s *hashStrategy) format(i int) string {
+	return fmt.Sprintf("_%0*d", s.width, i)
+}
+
+type rangeStrategy struct {
+	bounds []int64
+	width  int
+}
+
+// RangeStrategy 按照区间分表，bounds为递增的上界（不包含），value < bounds[i] 时落在第i张表
+// 例如 RangeStrategy(1000000, 2000000) 时，[0, 1000000) 为 _0，[1000000, 2000000) 为 _1，超出范围返回错误
+func RangeStrategy(bounds ...int64) ShardingStrategy {
+	if len(bounds) == 0 || !sort.SliceIsSorted(bounds, func(i, j int) bool { return bounds[i] < bounds[j] }) {
+		panic("orm: range bounds must be ascending")
+	}
+	return &rangeStrategy{bounds: bounds, width: len(strconv.Itoa(len(bounds) - 1))}
+}
+
+func (s *rangeStrategy) Suffix(value any) (string, error) {
+	i, ok := toInt64(value)
+	if !ok {
+		return "", fmt.Errorf("%w: %T", ErrInvalidShardValue, value)
+	}
+	index := sort.Search(len(s.bounds), func(n int) bool { return i < s.bounds[n] })
+	if index == len(s.bounds) {
+		return "", fmt.Errorf("%w: %d is out of range", ErrInvalidShardValue, i)
+	}
+	return fmt.Sprintf("_%0*d", s.width, index), nil
+}
+
+func (s *rangeStrategy) Suffixes() []string {
+	suffixes := make([]string, len(s.bounds))
+	for i := range suffixes {
+		suffixes[i] = fmt.Sprintf("_%0*d", s.width, i)
+	}
+	return suffixes
+}
+
+type monthlyIDStrategy struct {
+	generator *idx.GlobalIDGenerator
+	since     time.Time
+}
+
+// MonthlyIDStrategy 按照idx.GlobalIDGenerator生成的id中的时间按月分表，后缀为 _200601
+// 只需要id就能定位分表，since为第一张分表的月份，用于跨分表查询
+func MonthlyIDStrategy(generator *idx.GlobalIDGenerator, since time.Time) ShardingStrategy {
+	return &monthlyIDStrategy{generator: generator, since: since}
+}
+
+func (s *monthlyIDStrategy) Suffix(value any) (string, error) {
+	id, ok := toInt64(value)
+	if !ok || id <= 0 {
+		return "", fmt.Errorf("%w: %v", ErrInvalidShardValue, value)
+	}
+	return "_" + s.generator.ToTime(id).Format(shardingMonthLayout), nil
+}
+
+func (s *monthlyIDStrategy) Suffixes() []string {
+	var suffixes []string
+	month := time.Date(s.since.Year(), s.since.Month(), 1, 0, 0, 0, 0, s.since.Location())
+	for now := time.Now(); !month.After(now) && len(suffixes) < shardingMaxMonthShards; month = month.AddDate(0, 1, 0) {
+		suffixes = append(suffixes, "_"+month.Format(shardingMonthLayout))
+	}
+	return suffixes
+}
+
+// ShardingRule 逻辑表的分表规则
+type ShardingRule struct {
+	Table    string // 逻辑表名，例如orders
+	Key      string // 分表键的列名，例如user_id
+	Strategy ShardingStrategy
+}
+
+// TableFor 返回分表键的值对应的物理表名
+func (r *ShardingRule) TableFor(value any) (string, error) {
+	suffix, err := r.Strategy.Suffix(value)
+	if err != nil {
+		return "", err
+	}
+	return r.Table + suffix, nil
+}
+
+// Tables 返回所有物理表名
+func (r *ShardingRule) Tables() []string {
+	suffixes := r.Strategy.Suffixes()
+	tables := make([]string, len(suffixes))
+	for i, suffix := range suffixes {
+		tables[i] = r.Table + suffix
+	}
+	return tables
+}
+
+// ShardingPlugin 根据分表键把逻辑表改写为物理表
+// 查询、更新、删除从where条件或者model中查找分表键（= 或者 IN），创建从model中读取分表键
+// 多个值必须落在同一张分表，否则返回ErrCrossShard
+// 找不到分表键时返回ErrMissingShardingKey，需要跨分表查询时使用FanOut
+// 显式指定物理表（db.Table("orders_05")）时不做处理；原生SQL不做处理
+// 用法：db.Use(orm.NewShardingPlugin(&orm.ShardingRule{Table: "orders", Key: "user_id", Strategy: orm.HashStrategy(64)}))
+type ShardingPlugin struct {
+	rules map[string]*ShardingRule
+}
+
+func NewShardingPlugin(rules ...*ShardingRule) *ShardingPlugin {
+	p := &ShardingPlugin{rules: make(map[string]*ShardingRule, len(rules))}
+	for _, rule := range rules {
+		p.rules[rule.Table] = rule
+	}
+	return p
+}
+
+func (p *ShardingPlugin) Name() string {
+	return shardingPluginName
+}
+
+func (p *ShardingPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register(shardingPluginName, p.beforeCreate); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register(shardingPluginName, p.rewrite); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register(shardingPluginName, p.rewrite); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(shardingPluginName, p.rewrite); err != nil {
+		return err
+	}
+	return cb.Delete().Before("gorm:delete").Register(shardingPluginName, p.rewrite)
+}
+
+// Rule 返回逻辑表的分表规则
+func (p *ShardingPlugin) Rule(table string) (*ShardingRule, bool) {
+	rule, ok := p.rules[table]
+	return rule, ok
+}
+
+func (p *ShardingPlugin) beforeCreate(db *gorm.DB) {
+	rule, ok := p.rules[db.Statement.Table]
+	if !ok || db.Error != nil {
+		return
+	}
+	if db.Statement.Schema == nil {
+		_ = db.AddError(fmt.Errorf("%w: %s", ErrMissingShardingKey, rule.Key))
+		return
+	}
+	field := db.Statement.Schema.LookUpField(rule.Key)
+	if field == nil {
+		_ = db.AddError(fmt.Errorf("%w: %s", ErrMissingShardingKey, rule.Key))
+		return
+	}
+	var values []any
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			v, _ := field.ValueOf(db.Statement.Context, reflect.Indirect(rv.Index(i)))
+			values = append(values, v)
+		}
+	case reflect.Struct:
+		v, _ := field.ValueOf(db.Statement.Context, rv)
+		values = append(values, v)
+	}
+	p.route(db, rule, values)
+}
+
+func (p *ShardingPlugin) rewrite(db *gorm.DB) {
+	rule, ok := p.rules[db.Statement.Table]
+	if !ok || db.Error != nil {
+		return
+	}
+	var values []any
+	if c, ok := db.Statement.Clauses["WHERE"]; ok {
+		where, _ := c.Expression.(clause.Where)
+		values = findKeyValues(where.Exprs, rule.Key)
+	}
+	// 根据model更新、删除时从model中读取分表键
+	if len(values) == 0 && db.Statement.Schema != nil && db.Statement.ReflectValue.Kind() == reflect.Struct {
+		if field := db.Statement.Schema.LookUpField(rule.Key); field != nil {
+			if v, zero := field.ValueOf(db.Statement.Context, db.Statement.ReflectValue); !zero {
+				values = append(values, v)
+			}
+		}
+	}
+	p.route(db, rule, values)
+}
+
+// route 所有的值必须落在同一张分表
+func (p *ShardingPlugin) route(db *gorm.DB, rule *ShardingRule, values []any) {
+	if len(values) == 0 {
+		_ = db.AddError(fmt.Errorf("%w: %s", ErrMissingShardingKey, rule.Key))
+		return
+	}
+	var table string
+	for _, value := range values {
+		t, err := rule.TableFor(value)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		if table != "" && t != table {
+			_ = db.AddError(fmt.Errorf("%w: %s and %s", ErrCrossShard, table, t))
+			return
+		}
+		table = t
+	}
+	db.Statement.Table = table
+}
+
+// keyExprRegexp 匹配 user_id = ? 和 user_id IN ? 形式的条件
+var keyExprRegexp = regexp.MustCompile("(?i)^\\s*(?:[`\"\\[]?\\w+[`\"\\]]?\\.)?[`\"\\[]?(\\w+)[`\"\\]]?\\s*(=|IN)\\s*\\(?\\s*[?@$]\\w*\\s*\\)?\\s*$")
+
+// findKeyValues 从AND条件中查找分表键的值，OR条件中的值无法确定分表，会被忽略
+func findKeyValues(exprs []clause.Expression, key string) []any {
+	var values []any
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Eq:
+			if columnName(e.Column) == key {
+				values = append(values, e.Value)
+			}
+		case clause.IN:
+			if columnName(e.Column) == key {
+				values = append(values, e.Values...)
+			}
+		case clause.Expr:
+			values = append(values, exprKeyValues(e.SQL, e.Vars, key)...)
+		case clause.NamedExpr:
+			values = append(values, exprKeyValues(e.SQL, e.Vars, key)...)
+		case clause.AndConditions:
+			values = append(values, findKeyValues(e.Exprs, key)...)
+		}
+	}
+	return values
+}
+
+func exprKeyValues(sql string, vars []any, key string) []any {
+	m := keyExprRegexp.FindStringSubmatch(sql)
+	if m == nil || m[1] != key || len(vars) != 1 {
+		return nil
+	}
+	if strings.EqualFold(m[2], "IN") {
+		if values, err := toValues(vars[0]); err == nil {
+			return values
+		}
+		return nil
+	}
+	return vars
+}
+
+func columnName(column any) string {
+	switch c := column.(type) {
+	case string:
+		return c
+	case clause.Column:
+		return c.Name
+	}
+	return ""
+}
+
+func toInt64(value any) (int64, bool) {
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		return int64(u), u <= math.MaxInt64
+	case reflect.String:
+		i, err := strconv.ParseInt(rv.String(), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// toUint64 无符号整数以及超出int64范围的数字字符串，直接按照无符号数取模
+func toUint64(value any) (uint64, bool) {
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	case reflect.String:
+		if _, err := strconv.ParseInt(rv.String(), 10, 64); err == nil {
+			return 0, false
+		}
+		u, err := strconv.ParseUint(rv.String(), 10, 64)
+		return u, err == nil
+	}
+	return 0, false
+}
+
+// FanOut 在所有分表上执行查询并合并结果，用于管理后台等不带分表键的查询
+// query用于构建每张分表上的查询条件，排序和分页只在单张分表内生效，需要调用方对合并后的结果处理
+// 最多同时查询8张分表，在事务中时串行查询
+func FanOut[T any](ctx context.Context, db *gorm.DB, rule *ShardingRule, query func(tx *gorm.DB) *gorm.DB) ([]*T, error) {
+	tables := rule.Tables()
+	results := make([][]*T, len(tables))
+	errs := make([]error, len(tables))
+	parallel := defaultFanOutParallel
+	if InTx(ctx, db) {
+		// 同一个事务的连接不能并发使用
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, table := range tables {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			tx := FromCtx(ctx, db).Table(table)
+			if query != nil {
+				tx = query(tx)
+			}
+			errs[i] = tx.Find(&results[i]).Error
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	var list []*T
+	for _, result := range results {
+		list = append(list, result...)
+	}
+	return list, nil
+}
@@ -0,0 +1,74 @@
+package orm
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type testOrder struct {
+	ID     uint64
+	UserID int64
+	Amount int
+}
+
+func (testOrder) TableName() string {
+	return "orders"
+}
+
+func TestShardingPlugin(t *testing.T) {
+	db := New(newSQLiteConfig(t, "sharding.db"))
+	rule := &ShardingRule{Table: "orders", Key: "user_id", Strategy: HashStrategy(4)}
+	assert.NoError(t, db.Use(NewShardingPlugin(rule)))
+	for _, table := range rule.Tables() {
+		assert.NoError(t, db.Table(table).AutoMigrate(&testOrder{}))
+	}
+	assert.Equal(t, []string{"orders_0", "orders_1", "orders_2", "orders_3"}, rule.Tables())
+
+	for i := int64(1); i <= 8; i++ {
+		assert.NoError(t, db.Create(&testOrder{UserID: i, Amount: int(i)}).Error)
+	}
+	var count int64
+	assert.NoError(t, db.Table("orders_1").Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	var orders []testOrder
+	assert.NoError(t, db.Where("user_id = ?", 5).Find(&orders).Error)
+	assert.Len(t, orders, 1)
+	assert.NoError(t, db.Where(&testOrder{UserID: 6}).Find(&orders).Error)
+	assert.Len(t, orders, 1)
+	assert.NoError(t, db.Model(&orders[0]).Update("amount", 60).Error)
+	assert.NoError(t, db.Where("user_id IN ?", []int64{1, 5}).Find(&orders).Error)
+	assert.Len(t, orders, 2)
+
+	assert.ErrorIs(t, db.Where("amount > ?", 1).Find(&orders).Error, ErrMissingShardingKey)
+	assert.ErrorIs(t, db.Where("user_id IN ?", []int64{1, 2}).Find(&orders).Error, ErrCrossShard)
+	assert.ErrorIs(t, db.Create(&[]testOrder{{UserID: 1}, {UserID: 2}}).Error, ErrCrossShard)
+
+	all, err := FanOut[testOrder](context.Background(), db, rule, nil)
+	assert.NoError(t, err)
+	assert.Len(t, all, 8)
+	all, err = FanOut[testOrder](context.Background(), db, rule, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("amount >= ?", 8)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestShardingStrategy_Uint64(t *testing.T) {
+	hash := HashStrategy(10)
+	for _, value := range []any{uint64(math.MaxUint64), "18446744073709551615"} {
+		suffix, err := hash.Suffix(value)
+		assert.NoError(t, err)
+		assert.Equal(t, "_5", suffix)
+	}
+	suffix, err := hash.Suffix(int64(-15))
+	assert.NoError(t, err)
+	assert.Equal(t, "_5", suffix)
+
+	_, err = RangeStrategy(100).Suffix(uint64(math.MaxUint64))
+	assert.ErrorIs(t, err, ErrInvalidShardValue)
+}
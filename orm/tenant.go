@@ -0,0 +1,196 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	tenantPluginName    = "orm:tenant"
+	defaultTenantColumn = "tenant_id"
+	skipTenantKey       = "orm:skip_tenant"
+)
+
+var (
+	// ErrMissingTenant model包含租户列，但ctx中没有租户且没有显式跳过租户过滤
+	ErrMissingTenant = errors.New("orm: missing tenant in context")
+	// ErrTenantMismatch 创建时租户列的值与ctx中的租户不一致
+	ErrTenantMismatch = errors.New("orm: tenant mismatch")
+)
+
+type (
+	tenantCtxKey     struct{}
+	skipTenantCtxKey struct{}
+)
+
+// WithTenant 在ctx中设置当前租户
+func WithTenant(ctx context.Context, tenant any) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromCtx 返回ctx中的租户
+func TenantFromCtx(ctx context.Context) (tenant any, ok bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tenant = ctx.Value(tenantCtxKey{})
+	return tenant, tenant != nil
+}
+
+// WithoutTenant 跳过租户过滤，用于管理后台、定时任务等需要跨租户访问的场景
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipTenantCtxKey{}, true)
+}
+
+// SkipTenant 跳过租户过滤的scope，用法：db.Scopes(orm.SkipTenant).Find(&users)
+func SkipTenant(db *gorm.DB) *gorm.DB {
+	return db.Set(skipTenantKey, true)
+}
+
+// TenantPlugin 自动为包含租户列的model注入租户条件
+// 查询、更新、删除时追加 tenant_id = ? 条件，创建时填充租户列，租户列已有其他租户的值时返回ErrTenantMismatch
+// ctx中没有租户时返回ErrMissingTenant，避免遗漏租户条件导致越权访问
+// 原生SQL(Raw/Exec)不做处理
+// 用法：db.Use(orm.NewTenantPlugin())，db.WithContext(orm.WithTenant(ctx, tid)).Find(&users)
+type TenantPlugin struct {
+	Column string
+}
+
+func NewTenantPlugin() *TenantPlugin {
+	return &TenantPlugin{Column: defaultTenantColumn}
+}
+
+func (p *TenantPlugin) Name() string {
+	return tenantPluginName
+}
+
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register(tenantPluginName, p.beforeCreate); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register(tenantPluginName, p.queryCondition); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register(tenantPluginName, p.queryCondition); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(tenantPluginName, p.writeCondition); err != nil {
+		return err
+	}
+	return cb.Delete().Before("gorm:delete").Register(tenantPluginName, p.writeCondition)
+}
+
+// tenant 返回当前语句的租户，skip为true表示不需要处理
+func (p *TenantPlugin) tenant(db *gorm.DB) (tenant any, column string, skip bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, "", true
+	}
+	field := db.Statement.Schema.LookUpField(p.Column)
+	if field == nil {
+		return nil, "", true
+	}
+	if v, ok := db.Get(skipTenantKey); ok && v == true {
+		return nil, "", true
+	}
+	ctx := db.Statement.Context
+	if ctx != nil && ctx.Value(skipTenantCtxKey{}) != nil {
+		return nil, "", true
+	}
+	tenant, ok := TenantFromCtx(ctx)
+	if !ok {
+		_ = db.AddError(ErrMissingTenant)
+		return nil, "", true
+	}
+	return tenant, field.DBName, false
+}
+
+func (p *TenantPlugin) beforeCreate(db *gorm.DB) {
+	tenant, column, skip := p.tenant(db)
+	if skip {
+		return
+	}
+	setTenantField(db, db.Statement.Schema.LookUpField(column), tenant)
+}
+
+// setTenantField 租户列为空时填充ctx中的租户，不为空且与ctx中的租户不一致时返回ErrTenantMismatch，
+// 避免以租户A的身份写入租户B的数据
+func setTenantField(db *gorm.DB, field *schema.Field, tenant any) {
+	ctx := db.Statement.Context
+	set := func(row reflect.Value) bool {
+		value, zero := field.ValueOf(ctx, row)
+		if !zero {
+			if fmt.Sprint(value) != fmt.Sprint(tenant) {
+				_ = db.AddError(fmt.Errorf("%w: %v", ErrTenantMismatch, value))
+				return false
+			}
+			return true
+		}
+		if err := field.Set(ctx, row, tenant); err != nil {
+			_ = db.AddError(err)
+			return false
+		}
+		return true
+	}
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if !set(reflect.Indirect(rv.Index(i))) {
+				return
+			}
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
+
+func (p *TenantPlugin) queryCondition(db *gorm.DB) {
+	if tenant, column, skip := p.tenant(db); !skip {
+		addTenantCondition(db, column, tenant)
+	}
+}
+
+func (p *TenantPlugin) writeCondition(db *gorm.DB) {
+	tenant, column, skip := p.tenant(db)
+	if skip {
+		return
+	}
+	// 没有条件的全表更新/删除交给gorm返回ErrMissingWhereClause，不能因为租户条件而放行
+	if !db.AllowGlobalUpdate && !hasConditions(db) {
+		return
+	}
+	addTenantCondition(db, column, tenant)
+}
+
+func addTenantCondition(db *gorm.DB, column string, tenant any) {
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: tenant},
+	}})
+}
+
+// hasConditions 语句是否已有where条件，或者能从model的主键生成条件
+func hasConditions(db *gorm.DB) bool {
+	if _, ok := db.Statement.Clauses["WHERE"]; ok {
+		return true
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return false
+	}
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return rv.Len() > 0
+	case reflect.Struct:
+		_, zero := pk.ValueOf(db.Statement.Context, rv)
+		return !zero
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package orm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type testDoc struct {
+	BaseModel
+	TenantModel
+	Title string
+}
+
+func TestTenantPlugin(t *testing.T) {
+	db := New(newSQLiteConfig(t, "tenant.db"))
+	assert.NoError(t, db.Use(NewAuditPlugin()))
+	assert.NoError(t, db.Use(NewTenantPlugin()))
+	assert.NoError(t, db.AutoMigrate(&testDoc{}))
+
+	ctxA := WithOperator(WithTenant(context.Background(), "a"), "alice")
+	ctxB := WithOperator(WithTenant(context.Background(), "b"), "bob")
+	assert.NoError(t, db.WithContext(ctxA).Create(&[]testDoc{{Title: "a1"}, {Title: "a2"}}).Error)
+	doc := &testDoc{Title: "b1"}
+	assert.NoError(t, db.WithContext(ctxB).Create(doc).Error)
+	assert.Equal(t, "b", doc.TenantID)
+	assert.Equal(t, "bob", doc.CreatedBy)
+
+	// 不能以租户A的身份写入租户B的数据
+	foreign := &testDoc{Title: "forged", TenantModel: TenantModel{TenantID: "b"}}
+	assert.ErrorIs(t, db.WithContext(ctxA).Create(foreign).Error, ErrTenantMismatch)
+	assert.ErrorIs(t, db.WithContext(ctxA).Create(&[]testDoc{{Title: "ok"}, *foreign}).Error, ErrTenantMismatch)
+	same := &testDoc{Title: "a0", TenantModel: TenantModel{TenantID: "a"}}
+	assert.NoError(t, db.WithContext(ctxA).Create(same).Error)
+	assert.NoError(t, db.WithContext(ctxA).Unscoped().Delete(same).Error)
+
+	var docs []testDoc
+	assert.NoError(t, db.WithContext(ctxA).Find(&docs).Error)
+	assert.Len(t, docs, 2)
+	var count int64
+	assert.NoError(t, db.WithContext(ctxB).Model(&testDoc{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// 其他租户无法更新和删除
+	result := db.WithContext(ctxA).Model(doc).Update("title", "hacked")
+	assert.NoError(t, result.Error)
+	assert.Equal(t, int64(0), result.RowsAffected)
+	assert.NoError(t, db.WithContext(ctxA).Delete(doc).Error)
+	assert.NoError(t, db.WithContext(ctxB).Model(doc).Update("title", "b2").Error)
+	var got testDoc
+	assert.NoError(t, db.WithContext(ctxB).First(&got, doc.ID).Error)
+	assert.Equal(t, "b2", got.Title)
+	assert.Equal(t, "bob", got.UpdatedBy)
+
+	// 全表更新仍然被gorm拦截
+	assert.ErrorIs(t, db.WithContext(ctxA).Model(&testDoc{}).Update("title", "x").Error, gorm.ErrMissingWhereClause)
+
+	assert.ErrorIs(t, db.WithContext(context.Background()).Find(&docs).Error, ErrMissingTenant)
+	assert.NoError(t, db.WithContext(WithoutTenant(context.Background())).Find(&docs).Error)
+	assert.Len(t, docs, 3)
+
+	// 软删除
+	assert.NoError(t, db.WithContext(ctxB).Delete(doc).Error)
+	assert.NoError(t, db.Scopes(SkipTenant).Find(&docs).Error)
+	assert.Len(t, docs, 2)
+	assert.NoError(t, db.Scopes(SkipTenant).Unscoped().Find(&docs).Error)
+	assert.Len(t, docs, 3)
+}
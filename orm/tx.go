@@ -0,0 +1,92 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// txCtxKey 以根db的Config区分不同数据源的事务
+type txCtxKey struct {
+	config *gorm.Config
+}
+
+type txState struct {
+	tx     *gorm.DB
+	mux    sync.Mutex
+	hooks  []func(ctx context.Context)
+	parent *txState
+}
+
+func (s *txState) addHook(hook func(ctx context.Context)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// mergeToParent savepoint成功后将hook交给上一层事务，等最外层事务提交后再执行
+func (s *txState) mergeToParent() {
+	s.mux.Lock()
+	hooks := s.hooks
+	s.hooks = nil
+	s.mux.Unlock()
+	s.parent.mux.Lock()
+	defer s.parent.mux.Unlock()
+	s.parent.hooks = append(s.parent.hooks, hooks...)
+}
+
+// WithTx 在事务中执行fn，事务保存在ctx中，fn中通过 FromCtx(ctx, db) 获取当前事务
+// 如果ctx中已经存在同一个db的事务则使用savepoint嵌套，内层返回错误只会回滚到savepoint
+// fn返回错误或者panic时回滚事务，否则提交事务并执行通过AfterCommit注册的hook
+func WithTx(ctx context.Context, db *gorm.DB, fn func(ctx context.Context) error, opts ...*sql.TxOptions) error {
+	key := txCtxKey{config: db.Config}
+	parent, _ := ctx.Value(key).(*txState)
+	if parent != nil {
+		return parent.tx.Transaction(func(tx *gorm.DB) error {
+			state := &txState{tx: tx, parent: parent}
+			if err := fn(context.WithValue(ctx, key, state)); err != nil {
+				return err
+			}
+			state.mergeToParent()
+			return nil
+		})
+	}
+	state := &txState{}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state.tx = tx
+		return fn(context.WithValue(ctx, key, state))
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	for _, hook := range state.hooks {
+		hook(ctx)
+	}
+	return nil
+}
+
+// FromCtx 返回ctx中db对应的事务，没有事务时返回db本身
+func FromCtx(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if state, ok := ctx.Value(txCtxKey{config: db.Config}).(*txState); ok {
+		return state.tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// InTx ctx中是否存在db的事务
+func InTx(ctx context.Context, db *gorm.DB) bool {
+	_, ok := ctx.Value(txCtxKey{config: db.Config}).(*txState)
+	return ok
+}
+
+// AfterCommit 注册事务提交成功后执行的hook，例如删除缓存、发布事件
+// 事务（或者所在的savepoint）回滚时hook会被丢弃；ctx中没有事务时立即执行
+func AfterCommit(ctx context.Context, db *gorm.DB, hook func(ctx context.Context)) {
+	if state, ok := ctx.Value(txCtxKey{config: db.Config}).(*txState); ok {
+		state.addHook(hook)
+		return
+	}
+	hook(ctx)
+}
@@ -0,0 +1,52 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTx(t *testing.T) {
+	db := New(newSQLiteConfig(t, "tx.db"))
+	assert.NoError(t, db.AutoMigrate(&testUser{}))
+	ctx := context.Background()
+	errInner := errors.New("inner")
+
+	var hooks []string
+	err := WithTx(ctx, db, func(ctx context.Context) error {
+		assert.True(t, InTx(ctx, db))
+		if err := FromCtx(ctx, db).Create(&testUser{Name: "outer"}).Error; err != nil {
+			return err
+		}
+		AfterCommit(ctx, db, func(ctx context.Context) { hooks = append(hooks, "outer") })
+		err := WithTx(ctx, db, func(ctx context.Context) error {
+			if err := FromCtx(ctx, db).Create(&testUser{Name: "inner"}).Error; err != nil {
+				return err
+			}
+			AfterCommit(ctx, db, func(ctx context.Context) { hooks = append(hooks, "rollback") })
+			return errInner
+		})
+		assert.ErrorIs(t, err, errInner)
+		return WithTx(ctx, db, func(ctx context.Context) error {
+			AfterCommit(ctx, db, func(ctx context.Context) { hooks = append(hooks, "nested") })
+			return FromCtx(ctx, db).Create(&testUser{Name: "nested"}).Error
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer", "nested"}, hooks)
+
+	var names []string
+	assert.NoError(t, db.Model(&testUser{}).Order("id").Pluck("name", &names).Error)
+	assert.Equal(t, []string{"outer", "nested"}, names)
+
+	hooks = nil
+	err = WithTx(ctx, db, func(ctx context.Context) error {
+		AfterCommit(ctx, db, func(ctx context.Context) { hooks = append(hooks, "failed") })
+		return errInner
+	})
+	assert.ErrorIs(t, err, errInner)
+	assert.Empty(t, hooks)
+	assert.False(t, InTx(ctx, db))
+}
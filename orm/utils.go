@@ -1,6 +1,9 @@
 package orm
 
 import (
+	"strconv"
+	"strings"
+
 	"gorm.io/gorm"
 )
 
@@ -10,17 +13,60 @@ type PageResult[T any] struct {
 	PageSize   uint32
 	Total      uint64
 	TotalPages uint32
+	HasNext    bool
+}
+
+// CountMode Paginate统计总数的方式
+type CountMode int
+
+const (
+	CountExact     CountMode = iota // COUNT(*) 精确统计
+	CountSkip                       // 不统计总数，Total和TotalPages为0，通过HasNext判断是否有下一页
+	CountEstimated                  // 使用数据库的统计信息估算总数，只适用于没有过滤条件的全表分页，HasNext不依赖估算
+)
+
+type PaginateOpts struct {
+	CountMode CountMode
+}
+
+type PaginateOption func(o *PaginateOpts)
+
+// WithoutCount 分页时不执行COUNT(*)
+func WithoutCount() PaginateOption {
+	return func(o *PaginateOpts) {
+		o.CountMode = CountSkip
+	}
+}
+
+// WithEstimatedCount 分页时使用估算的总数
+// mysql使用information_schema.TABLES，postgres使用pg_class.reltuples，
+// sqlserver使用sys.dm_db_partition_stats，sqlite使用ANALYZE生成的sqlite_stat1
+// 统计信息可能过期（例如表从未ANALYZE时为0），总数至少为已经查询到的行数，HasNext通过多查询一行判断
+func WithEstimatedCount() PaginateOption {
+	return func(o *PaginateOpts) {
+		o.CountMode = CountEstimated
+	}
 }
 
 // Paginate 带total分页查询的封装
 // 需要在传递tx时将其他查询条件先构建到tx中
-func Paginate[T any](tx *gorm.DB, page, pageSize uint32) (*PageResult[T], error) {
+func Paginate[T any](tx *gorm.DB, page, pageSize uint32, options ...PaginateOption) (*PageResult[T], error) {
 	if page < 1 {
 		page = 1
 	}
 	if pageSize < 1 {
 		pageSize = 10
 	}
+	opts := &PaginateOpts{}
+	for _, op := range options {
+		op(opts)
+	}
+	switch opts.CountMode {
+	case CountSkip:
+		return paginateWithoutCount[T](tx, page, pageSize)
+	case CountEstimated:
+		return paginateWithEstimatedCount[T](tx, page, pageSize)
+	}
 	var total int64
 	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
 		return nil, err
@@ -43,5 +89,116 @@ func Paginate[T any](tx *gorm.DB, page, pageSize uint32) (*PageResult[T], error)
 		PageSize:   pageSize,
 		Total:      uint64(total),
 		TotalPages: totalPages,
+		HasNext:    page < totalPages,
+	}, nil
+}
+
+func paginateWithoutCount[T any](tx *gorm.DB, page, pageSize uint32) (*PageResult[T], error) {
+	list := []*T{}
+	if err := tx.Session(&gorm.Session{}).
+		Offset(int((page - 1) * pageSize)).
+		Limit(int(pageSize) + 1).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	hasNext := len(list) > int(pageSize)
+	if hasNext {
+		list = list[:pageSize]
+	}
+	return &PageResult[T]{
+		List:     list,
+		Page:     page,
+		PageSize: pageSize,
+		HasNext:  hasNext,
 	}, nil
 }
+
+func paginateWithEstimatedCount[T any](tx *gorm.DB, page, pageSize uint32) (*PageResult[T], error) {
+	total, err := estimatedCount[T](tx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := paginateWithoutCount[T](tx, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	// 统计信息过期时总数可能小于实际查询到的行数
+	seen := int64(page-1)*int64(pageSize) + int64(len(result.List))
+	if result.HasNext {
+		seen++
+	}
+	if len(result.List) > 0 && total < seen {
+		total = seen
+	}
+	result.Total = uint64(total)
+	result.TotalPages = uint32((total + int64(pageSize) - 1) / int64(pageSize))
+	return result, nil
+}
+
+// estimatedCount 返回估算的总数，没有统计信息时返回0
+func estimatedCount[T any](tx *gorm.DB) (int64, error) {
+	stmt, err := parseStatement[T](tx)
+	if err != nil {
+		return 0, err
+	}
+	var sql string
+	switch tx.Dialector.Name() {
+	case dialectMySQL:
+		sql = "SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?"
+	case dialectPostgres:
+		sql = "SELECT GREATEST(reltuples, 0)::bigint FROM pg_class WHERE oid = to_regclass(?)"
+	case dialectSQLServer:
+		sql = "SELECT SUM(row_count) FROM sys.dm_db_partition_stats WHERE object_id = OBJECT_ID(?) AND index_id IN (0, 1)"
+	case dialectSQLite:
+		return sqliteEstimatedCount(tx, stmt.Table)
+	default:
+		var total int64
+		err := tx.Session(&gorm.Session{}).Count(&total).Error
+		return total, err
+	}
+	var total *int64
+	if err := tx.Session(&gorm.Session{NewDB: true}).Raw(sql, stmt.Table).Scan(&total).Error; err != nil {
+		return 0, err
+	}
+	if total == nil || *total < 0 {
+		return 0, nil
+	}
+	return *total, nil
+}
+
+// sqliteEstimatedCount sqlite_stat1的stat第一个数字为行数，没有执行过ANALYZE时sqlite_stat1不存在
+func sqliteEstimatedCount(tx *gorm.DB, table string) (int64, error) {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var exists int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_stat1'").Scan(&exists).Error; err != nil {
+		return 0, err
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+	var stats []string
+	if err := db.Raw("SELECT stat FROM sqlite_stat1 WHERE tbl = ? ORDER BY idx IS NULL DESC LIMIT 1", table).Scan(&stats).Error; err != nil {
+		return 0, err
+	}
+	if len(stats) == 0 {
+		return 0, nil
+	}
+	fields := strings.Fields(stats[0])
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	total, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	return total, nil
+}
+
+// parseStatement 使用新的statement解析T，避免修改调用方tx中共享的statement
+func parseStatement[T any](tx *gorm.DB) (*gorm.Statement, error) {
+	stmt := &gorm.Statement{DB: tx, Table: tx.Statement.Table}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker 简单的熔断器
+// 连续失败threshold次后打开，cooldown之后进入半开状态，只放行一个探测请求
+// nil表示未启用熔断，所有请求都直接访问redis
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow 是否允许请求访问redis
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success 记录一次成功，返回熔断器之前是否处于打开状态
+func (b *breaker) success() (recovered bool) {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	recovered = b.failures >= b.threshold
+	b.failures = 0
+	b.probing = false
+	return recovered
+}
+
+// release 结束探测但不改变熔断状态，用于调用方取消、超时等无法判断redis是否可用的情况
+// 半开状态的探测请求必须调用success、failure或release之一，否则熔断器会一直处于打开状态
+func (b *breaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,199 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/byteflowing/go-common/trans"
+	limiterv1 "github.com/byteflowing/proto/gen/go/limiter/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrCircuitOpen = errors.New("redis limiter circuit open")
+
+// errUnexpectedResult lua返回值异常，不是redis不可用，不计入熔断
+var errUnexpectedResult = errors.New("unexpected Lua result")
+
+// DegradePolicy redis不可用时的降级策略
+type DegradePolicy int
+
+const (
+	DegradeNone       DegradePolicy = iota // 不降级，直接返回错误
+	DegradeFailOpen                        // 放行所有请求
+	DegradeFailClosed                      // 拒绝所有请求
+	DegradeLocal                           // 使用进程内限流器，规则按副本数均分
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+	defaultLocalMaxKeys     = 100000
+)
+
+// localLimiters redis不可用时使用的进程内限流器
+// redis恢复后会被清空
+type localLimiters struct {
+	mu       sync.Mutex
+	replicas uint64
+	limiters map[string]*Limiter
+}
+
+func newLocalLimiters(replicas int) *localLimiters {
+	if replicas < 1 {
+		replicas = 1
+	}
+	return &localLimiters{
+		replicas: uint64(replicas),
+		limiters: make(map[string]*Limiter),
+	}
+}
+
+// allow 所有规则都有令牌时才消耗令牌，返回第一个不满足的规则下标
+func (l *localLimiters) allow(keys []string, rules []*limiterv1.LimitRule) (blocked int, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiters := make([]*Limiter, len(keys))
+	for i, key := range keys {
+		limiters[i] = l.get(key, rules[i])
+		if limiters[i].Tokens() < 1 {
+			return i, rules[i].Duration.AsDuration() / time.Duration(l.limit(rules[i]))
+		}
+	}
+	for _, limiter := range limiters {
+		limiter.Allow()
+	}
+	return -1, 0
+}
+
+func (l *localLimiters) get(key string, rule *limiterv1.LimitRule) *Limiter {
+	if limiter, ok := l.limiters[key]; ok {
+		return limiter
+	}
+	if len(l.limiters) >= defaultLocalMaxKeys {
+		l.limiters = make(map[string]*Limiter)
+	}
+	limit := l.limit(rule)
+	limiter := NewLimiter(rule.Duration.AsDuration(), limit, limit)
+	l.limiters[key] = limiter
+	return limiter
+}
+
+func (l *localLimiters) limit(rule *limiterv1.LimitRule) uint64 {
+	limit := uint64(rule.Limit) / l.replicas
+	if limit == 0 {
+		limit = 1
+	}
+	return limit
+}
+
+func (l *localLimiters) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limiters = make(map[string]*Limiter)
+}
+
+// WithDegradePolicy : 设置redis不可用时的降级策略
+// replicas 为服务副本数，DegradeLocal时每个副本只允许规则次数的 1/replicas
+func WithDegradePolicy(policy DegradePolicy, replicas int) Option {
+	return func(o *Options) {
+		o.Degrade = policy
+		o.Replicas = replicas
+	}
+}
+
+// WithBreaker : 启用熔断，连续失败threshold次后熔断，cooldown后尝试恢复
+// 设置了降级策略时默认启用熔断，DegradeNone时熔断打开后返回ErrCircuitOpen
+func WithBreaker(threshold int, cooldown time.Duration) Option {
+	return func(o *Options) {
+		o.Breaker = true
+		if threshold > 0 {
+			o.BreakerThreshold = threshold
+		}
+		if cooldown > 0 {
+			o.BreakerCooldown = cooldown
+		}
+	}
+}
+
+// handleRedisErr 记录redis调用结果，返回是否需要走降级逻辑
+// 调用方取消或超时、lua返回值异常不计入熔断
+func (l *RedisLimiter) handleRedisErr(ctx context.Context, err error) (degrade bool) {
+	if err == nil {
+		if l.breaker.success() {
+			l.local.reset()
+		}
+		return false
+	}
+	if ctx.Err() != nil || errors.Is(err, errUnexpectedResult) {
+		l.breaker.release()
+		return false
+	}
+	l.breaker.failure()
+	return l.degrade != DegradeNone
+}
+
+func (l *RedisLimiter) degradeAllow(key string) (allowed bool, rule *limiterv1.LimitRule, err error) {
+	keys := make([]string, 0, len(l.windows))
+	for _, win := range l.windows {
+		keys = append(keys, l.getRedisKey(key, int(win.Duration.Seconds)))
+	}
+	result, err := l.degradeRules(keys, l.windows)
+	if err != nil {
+		return false, nil, err
+	}
+	if result.Rule == nil {
+		return result.Allowed, nil, nil
+	}
+	// 规则是所有key共用的，复制一份再写入RetryAfter
+	rule = proto.Clone(result.Rule).(*limiterv1.LimitRule)
+	rule.RetryAfter = trans.Int64(int64(result.RetryAfter.Seconds()))
+	return result.Allowed, rule, nil
+}
+
+func (l *RedisLimiter) degradeDimensions(dims []*Dimension) (*DimensionResult, error) {
+	var keys []string
+	var rules []*limiterv1.LimitRule
+	var owners []*Dimension
+	for _, dim := range dims {
+		for _, rule := range l.dimensionRules(dim) {
+			keys = append(keys, l.getDimensionKey(dim, int(rule.Duration.Seconds)))
+			rules = append(rules, rule)
+			owners = append(owners, dim)
+		}
+	}
+	result, err := l.degradeRules(keys, rules)
+	if err != nil {
+		return nil, err
+	}
+	if result.blocked >= 0 {
+		result.Dimension = owners[result.blocked]
+	}
+	return &result.DimensionResult, nil
+}
+
+type degradeResult struct {
+	DimensionResult
+	blocked int
+}
+
+func (l *RedisLimiter) degradeRules(keys []string, rules []*limiterv1.LimitRule) (*degradeResult, error) {
+	switch l.degrade {
+	case DegradeFailOpen:
+		return &degradeResult{DimensionResult: DimensionResult{Allowed: true}, blocked: -1}, nil
+	case DegradeFailClosed:
+		return &degradeResult{blocked: -1}, nil
+	case DegradeLocal:
+		blocked, retryAfter := l.local.allow(keys, rules)
+		if blocked < 0 {
+			return &degradeResult{DimensionResult: DimensionResult{Allowed: true}, blocked: -1}, nil
+		}
+		return &degradeResult{
+			DimensionResult: DimensionResult{Rule: rules[blocked], RetryAfter: retryAfter},
+			blocked:         blocked,
+		}, nil
+	default:
+		return nil, ErrCircuitOpen
+	}
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	redisWrapper "github.com/byteflowing/go-common/redis"
+	limiterv1 "github.com/byteflowing/proto/gen/go/limiter/v1"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func newUnreachableLimiter(options ...Option) *RedisLimiter {
+	rdb := &redisWrapper.Redis{
+		Cmdable: redis.NewClient(&redis.Options{
+			Addr:        "127.0.0.1:1",
+			MaxRetries:  -1,
+			DialTimeout: 100 * time.Millisecond,
+		}),
+	}
+	rules := []*limiterv1.LimitRule{
+		{Duration: durationpb.New(time.Minute), Limit: 4},
+	}
+	return NewRedisLimiter(rdb, "test:limit", rules, options...)
+}
+
+func TestRedisLimiter_DegradeNone(t *testing.T) {
+	// 未设置降级策略和熔断时始终返回redis错误
+	l := newUnreachableLimiter()
+	for i := 0; i < defaultBreakerThreshold+1; i++ {
+		_, _, err := l.Allow(context.Background(), "user")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+
+	l = newUnreachableLimiter(WithBreaker(1, time.Minute))
+	_, _, err := l.Allow(context.Background(), "user")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	_, _, err = l.Allow(context.Background(), "user")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+}
+
+func TestRedisLimiter_DegradeFailOpen(t *testing.T) {
+	l := newUnreachableLimiter(WithDegradePolicy(DegradeFailOpen, 1))
+	allowed, rule, err := l.Allow(context.Background(), "user")
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Nil(t, rule)
+}
+
+func TestRedisLimiter_DegradeFailClosed(t *testing.T) {
+	l := newUnreachableLimiter(WithDegradePolicy(DegradeFailClosed, 1))
+	allowed, _, err := l.Allow(context.Background(), "user")
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestRedisLimiter_DegradeLocal(t *testing.T) {
+	l := newUnreachableLimiter(WithDegradePolicy(DegradeLocal, 2), WithBreaker(1, time.Minute))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		allowed, _, err := l.Allow(ctx, "user")
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, rule, err := l.Allow(ctx, "user")
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+	assert.NotNil(t, rule.RetryAfter)
+	assert.Nil(t, l.windows[0].RetryAfter)
+
+	phone := &Dimension{Name: "phone", Key: "13800000000"}
+	ip := &Dimension{Name: "ip", Key: "127.0.0.1", Rules: []*limiterv1.LimitRule{
+		{Duration: durationpb.New(time.Minute), Limit: 2},
+	}}
+	result, err := l.AllowDimensions(ctx, phone, ip)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = l.AllowDimensions(ctx, phone, ip)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, ip, result.Dimension)
+	assert.Greater(t, result.RetryAfter, time.Duration(0))
+}
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, 20*time.Millisecond)
+	assert.True(t, b.allow())
+	b.failure()
+	assert.True(t, b.allow())
+	b.failure()
+	assert.False(t, b.allow())
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+	b.release()
+	assert.True(t, b.allow())
+	assert.True(t, b.success())
+	assert.True(t, b.allow())
+}
+
+func TestRedisLimiter_ProbeCanceled(t *testing.T) {
+	l := newUnreachableLimiter(WithBreaker(1, 20*time.Millisecond))
+	_, _, err := l.Allow(context.Background(), "user")
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	time.Sleep(30 * time.Millisecond)
+
+	// 探测请求被取消后，下一个请求仍然可以探测
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = l.Allow(ctx, "user")
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	_, _, err = l.Allow(context.Background(), "user")
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	_, _, err = l.Allow(context.Background(), "user")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/byteflowing/go-common/syncx"
+	limiterv1 "github.com/byteflowing/proto/gen/go/limiter/v1"
+	"github.com/redis/go-redis/v9"
+)
+
+// multiDimensionLua 先检查所有维度的所有规则，全部通过后才统一计数
+// 被限流的请求不会消耗其他维度的配额
+const multiDimensionLua = `
+for i = 1, #KEYS do
+	local limit = tonumber(ARGV[(i - 1) * 2 + 2])
+	local cnt = tonumber(redis.call("GET", KEYS[i]) or "0")
+	if cnt >= limit then
+		local ttl = redis.call("TTL", KEYS[i])
+		if ttl < 0 then
+			ttl = tonumber(ARGV[(i - 1) * 2 + 1])
+		end
+		return {100 + (i - 1), ttl}
+	end
+end
+for i = 1, #KEYS do
+	local duration = tonumber(ARGV[(i - 1) * 2 + 1])
+	local cnt = redis.call("INCR", KEYS[i])
+	if cnt == 1 then
+		redis.call("EXPIRE", KEYS[i], duration)
+	end
+end
+return {1, 0}
+`
+
+var multiScript *redis.Script
+var initMultiScript = syncx.Once(func() {
+	multiScript = redis.NewScript(multiDimensionLua)
+})
+
+func getMultiDimensionScript() *redis.Script {
+	initMultiScript()
+	return multiScript
+}
+
+var ErrNoDimension = errors.New("no dimension")
+
+// Dimension 限流维度，例如手机号、IP、设备号以及全局维度
+type Dimension struct {
+	Name  string                 // 维度名称，如 "phone", "ip", "device", "global"
+	Key   string                 // 维度的值，如手机号；全局维度可以为空
+	Rules []*limiterv1.LimitRule // 该维度的规则，为空时使用创建limiter时传入的规则
+}
+
+// DimensionResult 多维度限流的结果
+type DimensionResult struct {
+	Allowed    bool                 // 是否被允许
+	Dimension  *Dimension           // 被限制的维度，允许时为nil
+	Rule       *limiterv1.LimitRule // 被限制的规则，允许时为nil
+	RetryAfter time.Duration        // 被限制时还有多久解除限制
+}
+
+// AllowDimensions 在一次lua调用中原子地判断多个维度的所有规则
+// 所有规则都通过时才会为每个维度计数，任意一条规则不通过则返回第一个被限制的维度和规则
+// redis cluster下所有维度的key都使用同一个hash tag（默认为prefix，可通过WithHashTag修改），
+// 保证落在同一个slot上；如果单个slot压力过大，可以按业务场景拆分为多个不同prefix的limiter
+// redis不可用时按照WithDegradePolicy设置的策略降级
+func (l *RedisLimiter) AllowDimensions(ctx context.Context, dims ...*Dimension) (result *DimensionResult, err error) {
+	if len(dims) == 0 {
+		return nil, ErrNoDimension
+	}
+	if !l.breaker.allow() {
+		return l.degradeDimensions(dims)
+	}
+	result, err = l.allowDimensions(ctx, dims)
+	if l.handleRedisErr(ctx, err) {
+		return l.degradeDimensions(dims)
+	}
+	return result, err
+}
+
+func (l *RedisLimiter) allowDimensions(ctx context.Context, dims []*Dimension) (result *DimensionResult, err error) {
+	type position struct {
+		dim  *Dimension
+		rule *limiterv1.LimitRule
+	}
+	var positions []position
+	var redisKeys []string
+	var args []interface{}
+	for _, dim := range dims {
+		for _, rule := range l.dimensionRules(dim) {
+			seconds := int(rule.Duration.Seconds)
+			positions = append(positions, position{dim: dim, rule: rule})
+			redisKeys = append(redisKeys, l.getDimensionKey(dim, seconds))
+			args = append(args, seconds, rule.Limit)
+		}
+	}
+
+	res, err := l.multiScript.Run(ctx, l.rdb, redisKeys, args...).Result()
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := res.([]interface{})
+	if !ok || len(arr) != 2 {
+		return nil, fmt.Errorf("%w: %#v", errUnexpectedResult, res)
+	}
+	code, _ := arr[0].(int64)
+	ttl, _ := arr[1].(int64)
+
+	if code == 1 {
+		return &DimensionResult{Allowed: true}, nil
+	}
+	idx := code - 100
+	if idx < 0 || int(idx) >= len(positions) {
+		return nil, fmt.Errorf("%w: invalid limit index %d", errUnexpectedResult, idx)
+	}
+	return &DimensionResult{
+		Dimension:  positions[idx].dim,
+		Rule:       positions[idx].rule,
+		RetryAfter: time.Duration(ttl) * time.Second,
+	}, nil
+}
+
+// ResetDimensions 清除多个维度的计数
+func (l *RedisLimiter) ResetDimensions(ctx context.Context, dims ...*Dimension) error {
+	var redisKeys []string
+	for _, dim := range dims {
+		for _, rule := range l.dimensionRules(dim) {
+			redisKeys = append(redisKeys, l.getDimensionKey(dim, int(rule.Duration.Seconds)))
+		}
+	}
+	if len(redisKeys) == 0 {
+		return nil
+	}
+	return l.rdb.Del(ctx, redisKeys...).Err()
+}
+
+func (l *RedisLimiter) dimensionRules(dim *Dimension) []*limiterv1.LimitRule {
+	if len(dim.Rules) > 0 {
+		return dim.Rules
+	}
+	return l.windows
+}
+
+func (l *RedisLimiter) getDimensionKey(dim *Dimension, win int) string {
+	return fmt.Sprintf("%s:{%s}:%s:%s:%ds", l.prefix, l.hashTag, dim.Name, dim.Key, win)
+}
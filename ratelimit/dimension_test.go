@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redisWrapper "github.com/byteflowing/go-common/redis"
+	limiterv1 "github.com/byteflowing/proto/gen/go/limiter/v1"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func newMiniredisLimiter(t *testing.T) (*RedisLimiter, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := &redisWrapper.Redis{Cmdable: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	rules := []*limiterv1.LimitRule{
+		{Duration: durationpb.New(time.Minute), Limit: 1},
+	}
+	return NewRedisLimiter(rdb, "test:dim", rules), mr
+}
+
+func TestRedisLimiter_AllowDimensions(t *testing.T) {
+	l, mr := newMiniredisLimiter(t)
+	ctx := context.Background()
+	ipRule := &limiterv1.LimitRule{Duration: durationpb.New(time.Hour), Limit: 2}
+	phone := &Dimension{Name: "phone", Key: "13800000000"}
+	ip := &Dimension{Name: "ip", Key: "127.0.0.1", Rules: []*limiterv1.LimitRule{ipRule}}
+	phoneKey := l.getDimensionKey(phone, 60)
+	ipKey := l.getDimensionKey(ip, 3600)
+
+	result, err := l.AllowDimensions(ctx, phone, ip)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// phone被限制时ip不计数
+	mr.FastForward(20 * time.Second)
+	result, err = l.AllowDimensions(ctx, phone, ip)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, phone, result.Dimension)
+	assert.Equal(t, l.windows[0], result.Rule)
+	assert.Equal(t, 40*time.Second, result.RetryAfter)
+	count, err := mr.Get(ipKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", count)
+
+	// 其他手机号使用同一个ip，ip的规则生效
+	other := &Dimension{Name: "phone", Key: "13900000000"}
+	result, err = l.AllowDimensions(ctx, other, ip)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	third := &Dimension{Name: "phone", Key: "13700000000"}
+	result, err = l.AllowDimensions(ctx, third, ip)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, ip, result.Dimension)
+	assert.Equal(t, ipRule, result.Rule)
+	assert.Equal(t, time.Hour-20*time.Second, result.RetryAfter)
+	assert.False(t, mr.Exists(l.getDimensionKey(third, 60)))
+
+	// 重置后恢复
+	assert.NoError(t, l.ResetDimensions(ctx, phone, ip))
+	assert.False(t, mr.Exists(phoneKey))
+	assert.False(t, mr.Exists(ipKey))
+	result, err = l.AllowDimensions(ctx, phone, ip)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	_, err = l.AllowDimensions(ctx)
+	assert.ErrorIs(t, err, ErrNoDimension)
+}
+
+func TestRedisLimiter_DimensionPrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := &redisWrapper.Redis{Cmdable: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	rules := []*limiterv1.LimitRule{{Duration: durationpb.New(time.Minute), Limit: 1}}
+	sms := NewRedisLimiter(rdb, "sms:limit", rules, WithHashTag("limit"))
+	login := NewRedisLimiter(rdb, "login:limit", rules, WithHashTag("limit"))
+	ctx := context.Background()
+	dim := &Dimension{Name: "phone", Key: "13800000000"}
+
+	// hash tag相同但prefix不同时计数互不影响
+	result, err := sms.AllowDimensions(ctx, dim)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = login.AllowDimensions(ctx, dim)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = sms.AllowDimensions(ctx, dim)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+}
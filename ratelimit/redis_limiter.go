@@ -47,11 +47,27 @@ type Window struct {
 	Tag      string        // 标签，方便业务方感知被限流的窗口
 }
 
+type Options struct {
+	HashTag          string        // 多维度限流时所有key共用的hash tag，默认为prefix
+	Degrade          DegradePolicy // redis不可用时的降级策略，默认不降级
+	Replicas         int           // 服务副本数，用于DegradeLocal时均分规则
+	Breaker          bool          // 是否启用熔断，设置了降级策略时默认启用
+	BreakerThreshold int           // 连续失败多少次后熔断
+	BreakerCooldown  time.Duration // 熔断多久后尝试恢复
+}
+
+type Option func(o *Options)
+
 type RedisLimiter struct {
-	rdb     *redisWrapper.Redis
-	prefix  string
-	windows []*limiterv1.LimitRule
-	script  *redis.Script
+	rdb         *redisWrapper.Redis
+	prefix      string
+	hashTag     string
+	windows     []*limiterv1.LimitRule
+	script      *redis.Script
+	multiScript *redis.Script
+	degrade     DegradePolicy
+	breaker     *breaker
+	local       *localLimiters
 }
 
 // NewRedisLimiter : 创建带有滑动窗口的redis限流器，例如短信发送限制 1min 1次 5min 3次 1天 10次
@@ -59,12 +75,30 @@ type RedisLimiter struct {
 // @param windows参数需要按照依次递增的顺序传递进来
 // @param window.Duration 最小只能支持到秒级
 // @param window.Tag 用于业务标记方便前端拼接弹窗信息
-func NewRedisLimiter(rdb *redisWrapper.Redis, prefix string, rules []*limiterv1.LimitRule) *RedisLimiter {
+func NewRedisLimiter(rdb *redisWrapper.Redis, prefix string, rules []*limiterv1.LimitRule, options ...Option) *RedisLimiter {
+	ops := &Options{
+		HashTag:          prefix,
+		Replicas:         1,
+		BreakerThreshold: defaultBreakerThreshold,
+		BreakerCooldown:  defaultBreakerCooldown,
+	}
+	for _, op := range options {
+		op(ops)
+	}
+	var b *breaker
+	if ops.Breaker || ops.Degrade != DegradeNone {
+		b = newBreaker(ops.BreakerThreshold, ops.BreakerCooldown)
+	}
 	return &RedisLimiter{
-		rdb:     rdb,
-		prefix:  prefix,
-		windows: rules,
-		script:  getSlidingWindowScript(),
+		rdb:         rdb,
+		prefix:      prefix,
+		hashTag:     ops.HashTag,
+		windows:     rules,
+		script:      getSlidingWindowScript(),
+		multiScript: getMultiDimensionScript(),
+		degrade:     ops.Degrade,
+		breaker:     b,
+		local:       newLocalLimiters(ops.Replicas),
 	}
 }
 
@@ -73,7 +107,19 @@ func NewRedisLimiter(rdb *redisWrapper.Redis, prefix string, rules []*limiterv1.
 // @return blocked 如果不允许返回被限制的窗口
 // @return retryAfter 如果被限制还有多少s会解除限制
 // @return err 错误信息
+// redis不可用时按照WithDegradePolicy设置的策略降级，DegradeFailClosed时rule为nil
 func (l *RedisLimiter) Allow(ctx context.Context, key string) (allowed bool, rule *limiterv1.LimitRule, err error) {
+	if !l.breaker.allow() {
+		return l.degradeAllow(key)
+	}
+	allowed, rule, err = l.allow(ctx, key)
+	if l.handleRedisErr(ctx, err) {
+		return l.degradeAllow(key)
+	}
+	return allowed, rule, err
+}
+
+func (l *RedisLimiter) allow(ctx context.Context, key string) (allowed bool, rule *limiterv1.LimitRule, err error) {
 	var redisKeys []string
 	var args []interface{}
 
@@ -90,7 +136,7 @@ func (l *RedisLimiter) Allow(ctx context.Context, key string) (allowed bool, rul
 
 	arr, ok := res.([]interface{})
 	if !ok || len(arr) != 2 {
-		return false, nil, fmt.Errorf("unexpected Lua result: %#v", res)
+		return false, nil, fmt.Errorf("%w: %#v", errUnexpectedResult, res)
 	}
 	code, _ := arr[0].(int64)
 	ttl, _ := arr[1].(int64)
@@ -101,7 +147,7 @@ func (l *RedisLimiter) Allow(ctx context.Context, key string) (allowed bool, rul
 
 	idx := code - 100
 	if idx < 0 || int(idx) >= len(l.windows) {
-		return false, nil, fmt.Errorf("invalid limit index %d", idx)
+		return false, nil, fmt.Errorf("%w: invalid limit index %d", errUnexpectedResult, idx)
 	}
 	rule = l.windows[idx]
 	rule.RetryAfter = trans.Int64(ttl)
@@ -120,3 +166,13 @@ func (l *RedisLimiter) Reset(ctx context.Context, key string) error {
 func (l *RedisLimiter) getRedisKey(key string, win int) string {
 	return fmt.Sprintf("%s:{%s}:%ds", l.prefix, key, win)
 }
+
+// WithHashTag : 设置多维度限流时key使用的hash tag
+// redis cluster要求同一个lua脚本的所有key位于同一个slot，所有维度的key都会带上{tag}
+func WithHashTag(tag string) Option {
+	return func(o *Options) {
+		if tag != "" {
+			o.HashTag = tag
+		}
+	}
+}